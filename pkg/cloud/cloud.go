@@ -0,0 +1,257 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clouds with a built-in metadata service lookup
+const (
+	AWS   = "aws"
+	GCP   = "gcp"
+	Azure = "azure"
+)
+
+const (
+	defaultTimeout       = 2 * time.Second
+	defaultRetryInterval = time.Minute
+	maxRetryInterval     = time.Hour
+)
+
+// defaultClient is shared by the lookups without IMDS.Client. It bypasses the proxy,
+// and as a lookup is rare it doesn't keep connections alive.
+var defaultClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+var defaultEndpoints = map[string]string{
+	AWS:   "http://169.254.169.254",
+	GCP:   "http://metadata.google.internal",
+	Azure: "http://169.254.169.254",
+}
+
+type (
+	// Provider supplies tags describing where the process runs, such as the
+	// instance id, availability zone and region.
+	Provider interface {
+		Tags(ctx context.Context) (map[string]string, error)
+	}
+
+	// IMDS is a Provider querying the instance metadata service of a cloud. The
+	// service is queried until a lookup succeeds, whose tags are then cached for the
+	// lifetime of the process. A failed lookup is cached too, and returned without
+	// querying the service until RetryInterval has passed, so hosts without a metadata
+	// service, e.g. dev machines, don't wait for the lookup timeout on every call.
+	IMDS struct {
+		// Cloud is one of AWS, GCP or Azure.
+		Cloud string
+
+		// Endpoint is the base URL of the metadata service. Defaults to the link-local
+		// address of Cloud.
+		Endpoint string
+
+		// Timeout bounds the whole lookup. Defaults to 2 seconds.
+		Timeout time.Duration
+
+		// Client is the HTTP client to use. Defaults to a client without proxy.
+		Client *http.Client
+
+		// RetryInterval is the delay before a failed lookup is retried, doubled after
+		// every consecutive failure up to an hour. Defaults to 1 minute.
+		RetryInterval time.Duration
+
+		mu      sync.Mutex
+		tags    map[string]string
+		err     error
+		retryAt time.Time
+		backoff time.Duration
+	}
+)
+
+// NewIMDS creates a Provider for the metadata service of cloud.
+func NewIMDS(cloud string) (*IMDS, error) {
+	if _, ok := defaultEndpoints[cloud]; !ok {
+		return nil, fmt.Errorf("cloud: unknown provider %q", cloud)
+	}
+	return &IMDS{Cloud: cloud}, nil
+}
+
+// Tags returns the "cloud.provider", "cloud.instance_id", "cloud.zone" and
+// "cloud.region" tags. Values the service doesn't provide are left out.
+func (m *IMDS) Tags(ctx context.Context) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tags != nil {
+		return m.tags, nil
+	}
+	if m.err != nil && time.Now().Before(m.retryAt) {
+		return nil, m.err
+	}
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tags, err := m.lookup(ctx)
+	if err != nil {
+		switch {
+		case m.backoff == 0 && m.RetryInterval > 0:
+			m.backoff = m.RetryInterval
+		case m.backoff == 0:
+			m.backoff = defaultRetryInterval
+		case m.backoff < maxRetryInterval:
+			m.backoff *= 2
+		}
+		m.err = fmt.Errorf("%v (retrying in %s)", err, m.backoff)
+		m.retryAt = time.Now().Add(m.backoff)
+		return nil, m.err
+	}
+	m.tags, m.err = tags, nil
+	return tags, nil
+}
+
+func (m *IMDS) lookup(ctx context.Context) (map[string]string, error) {
+	var (
+		info instance
+		err  error
+	)
+	switch m.Cloud {
+	case AWS:
+		info, err = m.aws(ctx)
+	case GCP:
+		info, err = m.gcp(ctx)
+	case Azure:
+		info, err = m.azure(ctx)
+	default:
+		err = fmt.Errorf("cloud: unknown provider %q", m.Cloud)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info.tags(m.Cloud), nil
+}
+
+type instance struct {
+	id, zone, region string
+}
+
+func (i instance) tags(cloud string) map[string]string {
+	tags := map[string]string{"cloud.provider": cloud}
+	for k, v := range map[string]string{
+		"cloud.instance_id": i.id,
+		"cloud.zone":        i.zone,
+		"cloud.region":      i.region,
+	} {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+func (m *IMDS) aws(ctx context.Context) (instance, error) {
+	var info instance
+	token, err := m.get(ctx, http.MethodPut, "/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil {
+		return info, err
+	}
+
+	header := map[string]string{"X-aws-ec2-metadata-token": token}
+	for path, v := range map[string]*string{
+		"/latest/meta-data/instance-id":                 &info.id,
+		"/latest/meta-data/placement/availability-zone": &info.zone,
+		"/latest/meta-data/placement/region":            &info.region,
+	} {
+		if *v, err = m.get(ctx, http.MethodGet, path, header); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+func (m *IMDS) gcp(ctx context.Context) (instance, error) {
+	var info instance
+	header := map[string]string{"Metadata-Flavor": "Google"}
+
+	id, err := m.get(ctx, http.MethodGet, "/computeMetadata/v1/instance/id", header)
+	if err != nil {
+		return info, err
+	}
+	// projects/<number>/zones/<zone>
+	zone, err := m.get(ctx, http.MethodGet, "/computeMetadata/v1/instance/zone", header)
+	if err != nil {
+		return info, err
+	}
+
+	info.id = id
+	info.zone = zone[strings.LastIndex(zone, "/")+1:]
+	if i := strings.LastIndex(info.zone, "-"); i > 0 {
+		info.region = info.zone[:i]
+	}
+	return info, nil
+}
+
+func (m *IMDS) azure(ctx context.Context) (instance, error) {
+	var info instance
+	body, err := m.get(ctx, http.MethodGet, "/metadata/instance/compute?api-version=2021-02-01&format=json",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return info, err
+	}
+
+	compute := struct {
+		VMID     string `json:"vmId"`
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &compute); err != nil {
+		return info, fmt.Errorf("cloud: malformed azure metadata: %v", err)
+	}
+
+	info.id = compute.VMID
+	info.region = compute.Location
+	if compute.Zone != "" {
+		info.zone = compute.Location + "-" + compute.Zone
+	}
+	return info, nil
+}
+
+func (m *IMDS) get(ctx context.Context, method, path string, header map[string]string) (string, error) {
+	endpoint := m.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoints[m.Cloud]
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpoint, "/")+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	client := m.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cloud: %s %s: %s", method, path, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(body)), err
+}
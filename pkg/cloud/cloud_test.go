@@ -0,0 +1,150 @@
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIMDSAWS(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			_, _ = w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			_, _ = w.Write([]byte("i-0123456789"))
+		case "/latest/meta-data/placement/availability-zone":
+			_, _ = w.Write([]byte("eu-west-1a"))
+		case "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte("eu-west-1"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewIMDS(AWS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Endpoint = srv.URL
+
+	tags, err := p.Tags(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"cloud.provider":    "aws",
+		"cloud.instance_id": "i-0123456789",
+		"cloud.zone":        "eu-west-1a",
+		"cloud.region":      "eu-west-1",
+	}
+	for k, v := range expected {
+		if tags[k] != v {
+			t.Errorf("unexpected tag %s:\ngot: %s\nexp: %s", k, tags[k], v)
+		}
+	}
+
+	seen := requests
+	if _, err := p.Tags(context.Background()); err != nil || requests != seen {
+		t.Errorf("expected cached tags, got %d more requests (err: %v)", requests-seen, err)
+	}
+}
+
+func TestIMDSGCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			_, _ = w.Write([]byte("4242"))
+		case "/computeMetadata/v1/instance/zone":
+			_, _ = w.Write([]byte("projects/1234/zones/us-central1-b"))
+		}
+	}))
+	defer srv.Close()
+
+	p := &IMDS{Cloud: GCP, Endpoint: srv.URL}
+	tags, err := p.Tags(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags["cloud.zone"] != "us-central1-b" || tags["cloud.region"] != "us-central1" || tags["cloud.instance_id"] != "4242" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestIMDSRetry(t *testing.T) {
+	available := false
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("projects/1234/zones/us-central1-b"))
+	}))
+	defer srv.Close()
+
+	p := &IMDS{Cloud: GCP, Endpoint: srv.URL, RetryInterval: 50 * time.Millisecond}
+	if _, err := p.Tags(context.Background()); err == nil {
+		t.Fatal("expected error while the service is unavailable")
+	}
+
+	available = true
+	if _, err := p.Tags(context.Background()); err == nil || requests != 1 {
+		t.Fatalf("expected the failure to be cached until RetryInterval, got %d requests (err: %v)", requests, err)
+	}
+
+	time.Sleep(p.RetryInterval)
+	tags, err := p.Tags(context.Background())
+	if err != nil {
+		t.Fatalf("expected failed lookup to be retried, got %v", err)
+	}
+	if tags["cloud.zone"] != "us-central1-b" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestIMDSTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := &IMDS{Cloud: AWS, Endpoint: srv.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	tags, err := p.Tags(context.Background())
+	if err == nil {
+		t.Error("expected timeout error")
+	}
+	if len(tags) != 0 {
+		t.Errorf("expected no tags, got %v", tags)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup not bounded by timeout, took %s", elapsed)
+	}
+
+	if _, err := NewIMDS("unknown"); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
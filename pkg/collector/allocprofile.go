@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type (
+	// AllocSite represents the bytes allocated by a single function since the previous snapshot.
+	AllocSite struct {
+		Name  string
+		Bytes int64
+	}
+
+	// AllocProfiler computes the top allocation sites between successive runtime.MemProfile
+	// snapshots. Reading the profile walks every sampled stack, so it is meant to be used
+	// with long intervals.
+	AllocProfiler struct {
+		// TopN limits the number of sites returned by Snapshot. Defaults to 5.
+		TopN int
+
+		prev map[string]int64
+	}
+)
+
+// NewAllocProfiler creates a new AllocProfiler returning at most topN sites per snapshot.
+func NewAllocProfiler(topN int) *AllocProfiler {
+	if topN <= 0 {
+		topN = 5
+	}
+	return &AllocProfiler{TopN: topN}
+}
+
+// Snapshot reads the memory profile and returns the sites with the largest growth of
+// allocated bytes since the previous call, largest first. The first call reports the
+// totals since the process start. As the profile is updated by the garbage collector,
+// results lag up to two GC cycles behind.
+func (p *AllocProfiler) Snapshot() []AllocSite {
+	current := allocBySite()
+
+	sites := make([]AllocSite, 0, len(current))
+	for name, bytes := range current {
+		if delta := bytes - p.prev[name]; delta > 0 {
+			sites = append(sites, AllocSite{Name: name, Bytes: delta})
+		}
+	}
+	p.prev = current
+
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].Bytes == sites[j].Bytes {
+			return sites[i].Name < sites[j].Name
+		}
+		return sites[i].Bytes > sites[j].Bytes
+	})
+	if len(sites) > p.TopN {
+		sites = sites[:p.TopN]
+	}
+	return sites
+}
+
+func allocBySite() map[string]int64 {
+	var records []runtime.MemProfileRecord
+	n, _ := runtime.MemProfile(nil, true)
+	for {
+		records = make([]runtime.MemProfileRecord, n+50)
+		var ok bool
+		if n, ok = runtime.MemProfile(records, true); ok {
+			records = records[:n]
+			break
+		}
+	}
+
+	sites := make(map[string]int64, len(records))
+	for i := range records {
+		sites[siteName(records[i].Stack())] += records[i].AllocBytes
+	}
+	return sites
+}
+
+// siteName returns the first function of the stack outside of the runtime package.
+func siteName(stack []uintptr) string {
+	frames := runtime.CallersFrames(stack)
+	name := "unknown"
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			name = frame.Function
+			if !strings.HasPrefix(name, "runtime.") {
+				return name
+			}
+		}
+		if !more {
+			return name
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var allocSink [][]byte
+
+//go:noinline
+func allocateForProfile() {
+	for i := 0; i < 1000; i++ {
+		allocSink = append(allocSink, make([]byte, 64<<10))
+	}
+}
+
+func TestAllocProfiler(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+
+	p := NewAllocProfiler(3)
+	p.Snapshot()
+
+	allocateForProfile()
+	allocSink = nil
+	runtime.GC()
+	runtime.GC()
+
+	sites := p.Snapshot()
+	if len(sites) == 0 || len(sites) > 3 {
+		t.Fatalf("unexpected number of sites: %d", len(sites))
+	}
+	if !strings.HasSuffix(sites[0].Name, "allocateForProfile") {
+		t.Errorf("unexpected top site:\ngot: %s\nexp: *allocateForProfile", sites[0].Name)
+	}
+	if sites[0].Bytes < 1000*64<<10 {
+		t.Errorf("top site reported too few bytes: %d", sites[0].Bytes)
+	}
+}
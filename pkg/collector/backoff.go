@@ -0,0 +1,38 @@
+package collector
+
+import "time"
+
+// backOff updates the backed off pause after a collection which took d. While
+// collections take longer than SlowCollectThreshold, the pause is doubled, from twice
+// PauseDur up to MaxPauseDur, and it is halved back to PauseDur once they are fast
+// again. c.mu must be held.
+func (c *Collector) backOff(d time.Duration) {
+	if c.SlowCollectThreshold <= 0 {
+		return
+	}
+
+	if d > c.SlowCollectThreshold {
+		next := 2 * c.backoff
+		if next < 2*c.PauseDur {
+			next = 2 * c.PauseDur
+		}
+		if max := c.maxPauseDur(); next > max {
+			next = max
+		}
+		c.backoff = next
+		return
+	}
+
+	c.backoff /= 2
+	if c.backoff <= c.PauseDur {
+		c.backoff = 0
+	}
+}
+
+// maxPauseDur returns MaxPauseDur, or 8 times PauseDur when it is not set.
+func (c *Collector) maxPauseDur() time.Duration {
+	if c.MaxPauseDur > 0 {
+		return c.MaxPauseDur
+	}
+	return 8 * c.PauseDur
+}
@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cgroupMemFiles lists the memory limit and usage files of the cgroup v2 unified
+// hierarchy, then of the cgroup v1 memory controller, as mounted in a container.
+var cgroupMemFiles = []struct {
+	limit, usage string
+}{
+	{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory.current"},
+	{"/sys/fs/cgroup/memory/memory.limit_in_bytes", "/sys/fs/cgroup/memory/memory.usage_in_bytes"},
+}
+
+// collectCgroupMem reports the memory limit and usage of the cgroup of the process as
+// "mem.cgroup.limit" and "mem.cgroup.usage". Nothing is reported outside Linux or
+// when neither cgroup version is mounted, and the limit is omitted when unlimited.
+func (c *Collector) collectCgroupMem(f *Fields) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	for _, files := range cgroupMemFiles {
+		usage, usageStale, err := c.readCgroupValue(files.usage)
+		if err != nil {
+			continue
+		}
+		f.setExtra("mem.cgroup.usage", usage)
+
+		limit, limitStale, err := c.readCgroupValue(files.limit)
+		if err == nil && limit > 0 {
+			f.setExtra("mem.cgroup.limit", limit)
+		}
+		f.setExtra("mem.cgroup.stale", usageStale || limitStale)
+		return
+	}
+}
+
+// readCgroupValue reads the byte count in path, "max" being reported as 0.
+func (c *Collector) readCgroupValue(path string) (int64, bool, error) {
+	data, stale, err := c.readProcFile(path)
+	if err != nil {
+		return 0, stale, err
+	}
+
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, stale, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, stale, err
+}
@@ -1,7 +1,11 @@
 package collector
 
 import (
+	"math"
+	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,15 +30,202 @@ type (
 		// statistics and the Run function should return.
 		Done <-chan struct{}
 
+		// CounterDeltas lists counter keys for which the increase since the previous
+		// collection is additionally reported as "<key>_delta".
+		CounterDeltas []string
+
+		// Derived lists derived values to compute on each collection, such as rates and
+		// ratios. See DerivedNames for the available ones.
+		Derived []string
+
+		// IdlePauseDur, when positive, replaces PauseDur while the process is idle, that is
+		// while both the goroutine count and the allocation rate stay within IdleGoroutines
+		// and IdleAllocRate. PauseDur is restored as soon as activity resumes.
+		IdlePauseDur time.Duration
+
+		// IdleGoroutines is the largest change of the goroutine count in-between two
+		// collections which is still considered idle.
+		IdleGoroutines int
+
+		// IdleAllocRate is the highest allocation rate, in bytes per second, which is
+		// still considered idle. Defaults to 64 KiB/s, well above the allocations of the
+		// collections themselves.
+		IdleAllocRate float64
+
+		// CollectOnGC triggers an additional collection after every completed garbage
+		// collection cycle, giving accurate per-GC heap readings. Defaults to false.
+		CollectOnGC bool
+
+		// CorrectDrift schedules collections at fixed offsets from the first one instead of
+		// relying on a time.Ticker, shortening the next pause after a late collection so
+		// the average interval stays at PauseDur. Defaults to false.
+		CorrectDrift bool
+
+		// StartDelay postpones the first collection, e.g. to let the application warm up
+		// before cold-start values reach dashboards. Defaults to 0.
+		StartDelay time.Duration
+
+		// EmitSeq reports a "seq" value incremented by one on every collection, starting at 1,
+		// so gaps in the stored stream reveal dropped points. Defaults to false.
+		EmitSeq bool
+
+		// GoroutineLimit is an absolute ceiling of the goroutine count. When a collection
+		// observes more goroutines, OnGoroutineLimit is called once, and again only after
+		// the count dropped back to the limit or below. Defaults to 0, which disables it.
+		GoroutineLimit int
+
+		// OnGoroutineLimit is called with the goroutine count exceeding GoroutineLimit.
+		OnGoroutineLimit func(int)
+
+		// EnableSchedStats reports the percentiles of the scheduler latencies, the time
+		// goroutines spent runnable before running, since the previous collection as
+		// "sched.latency.p50", "sched.latency.p90" and "sched.latency.p99", in seconds. The
+		// first collection reports them since the process started. It requires Go 1.17 or
+		// later, the values are omitted otherwise. Defaults to false.
+		EnableSchedStats bool
+
+		// GCPausePercentiles reports the percentiles of the GC pauses which ended since the
+		// previous collection, "mem.gc.pause.p50", "mem.gc.pause.p90", "mem.gc.pause.p99"
+		// and "mem.gc.pause.max", read from the last 256 pauses kept by the runtime.
+		// They are omitted when no GC cycle ran. Defaults to false.
+		GCPausePercentiles bool
+
+		// GoroutineSampleInterval samples the goroutine count between collections, so
+		// "cpu.goroutines.min" and "cpu.goroutines.max" report the range over the whole
+		// collection window and reveal short spikes. Without sampling, the range only
+		// covers the count of the collection. Defaults to 0, which disables sampling.
+		GoroutineSampleInterval time.Duration
+
+		// SlowCollectThreshold enables the back off of slow collections, e.g. on large heaps
+		// where ReadMemStats stops the world noticeably: after a collection taking longer
+		// than it, see "runtime.collect.duration_ns", the pause is doubled up to
+		// MaxPauseDur, and it is halved back to PauseDur once collections are fast again.
+		// The pause in effect is reported as "runtime.collect.interval_ns". Defaults to 0,
+		// which disables it.
+		SlowCollectThreshold time.Duration
+
+		// MaxPauseDur bounds the pause backed off by SlowCollectThreshold. Defaults to 0,
+		// which allows up to 8 times PauseDur.
+		MaxPauseDur time.Duration
+
+		// Trigger, when receiving a value, causes an immediate collection in addition to
+		// the periodic ones, aligning collections with application events.
+		Trigger <-chan struct{}
+
+		// TriggerOnly disables the periodic collections, including the first one when Run
+		// is called, so statistics are only collected on Trigger (and after GC cycles with
+		// CollectOnGC). Defaults to false.
+		TriggerOnly bool
+
+		// SkipMemStatsWhenBusy avoids the stop-the-world runtime.ReadMemStats call while
+		// the process is busy, that is while it runs more than BusyGoroutines goroutines.
+		// The memory statistics of the last full read are reported instead and a
+		// "mem.stale" value tells them apart. The runtime exposes no way to tell a running
+		// garbage collection without stopping the world, so the goroutine count is the only
+		// busy signal. Defaults to false.
+		SkipMemStatsWhenBusy bool
+
+		// BusyGoroutines is the goroutine count above which the process is considered busy
+		// by SkipMemStatsWhenBusy.
+		BusyGoroutines int
+
+		// CollectIf, when set, is called before every collection, which is skipped when it
+		// returns false, e.g. to only collect on the leader of a cluster. It applies to all
+		// collections, including those on Trigger and after GC cycles. Defaults to nil.
+		CollectIf func() bool
+
+		// ProcessReadTimeout bounds the reads of process and OS files, such as those in
+		// /proc, so a stalled filesystem never blocks a collection. On timeout, the values
+		// of the last successful read are reported and flagged as stale. Defaults to 1
+		// second.
+		ProcessReadTimeout time.Duration
+
+		// EnableRuntimeMetrics adds values read from the runtime/metrics package, available
+		// since Go 1.16, such as the 64-bit "mem.gc.cycles_total" counter which, unlike
+		// "mem.gc.count", never wraps, the GC CPU time breakdown "mem.gc.cpu.*_seconds"
+		// on Go 1.20 and later, and the percentiles of the GC pause and allocation size
+		// histograms since the previous collection, "mem.gc.pauses_seconds.p50" and
+		// "mem.heap.allocs_by_size_bytes.p50" up to ".p99". Values unsupported by the Go
+		// version are omitted, except "mem.gc.cycles_total" which falls back to the
+		// MemStats value. Defaults to false.
+		EnableRuntimeMetrics bool
+
+		// EnableCgroupMem reports the memory limit and usage of the cgroup of the process,
+		// "mem.cgroup.limit" and "mem.cgroup.usage" in bytes, read from the cgroup v2 or v1
+		// files mounted in /sys/fs/cgroup, so the heap can be compared with the limit of
+		// the container rather than the memory of the host. "mem.cgroup.stale" tells
+		// whether the values come from a timed out read, see ProcessReadTimeout. The values
+		// are omitted outside Linux, without cgroup files, and the limit when unlimited.
+		// Defaults to false.
+		EnableCgroupMem bool
+
+		// EnableProcessCPU reports the CPU time used by the process, user and system, since
+		// the previous collection as a percentage of the elapsed time, "cpu.process.percent",
+		// which exceeds 100 when several cores are busy. It is read with getrusage, so it is
+		// omitted on other platforms, such as Windows, and on the first collection.
+		// Defaults to false.
+		EnableProcessCPU bool
+
+		// EnableProcessMem reports the memory of the process as seen by the OS, beyond the
+		// memory managed by the Go runtime: the resident set size, "mem.process.rss", which
+		// the OOM killer acts on, and the virtual memory size, "mem.process.vsize", in bytes.
+		// They are read from /proc/self/statm and omitted outside Linux. "mem.process.stale"
+		// tells whether they come from a timed out read, see ProcessReadTimeout. Defaults to
+		// false.
+		EnableProcessMem bool
+
+		// EnableFDs reports the number of open file descriptors of the process,
+		// "proc.open_fds", counted in /proc/self/fd within ProcessReadTimeout, and their soft
+		// limit, "proc.max_fds", to alert on descriptor leaks. "proc.fds.stale" tells
+		// whether the count comes from a timed out listing. They are omitted outside Linux.
+		// Defaults to false.
+		EnableFDs bool
+
+		clock              clock
+		readMemStats       func(*runtime.MemStats)
+		numGoroutine       func() int
+		readRuntimeMetrics func() map[string]interface{}
+		readHistogram      func(name string) *histogram
+		readCPUTime        func() (time.Duration, bool)
+		procReader         *procReader
+		fdReader           *procReader
+
 		collectStatsCallback CollectStatsCallback
+
+		defaultsOnce sync.Once
+
+		callbacksMu sync.Mutex
+		callbacks   []CollectStatsCallback
+
+		mu        sync.Mutex
+		counters  map[string]int64
+		activity  activity
+		seq       int64
+		overLimit bool
+		backoff   time.Duration
+		lastCPU   time.Duration
+		lastCPUAt time.Time
+		prev      *Fields
+		prevAt    time.Time
+		lastMem   *runtime.MemStats
+
+		goroutines goroutineRange
+		lastNumGC  uint32
+		histograms map[string]*histogram
+
+		heapAllocPeak int64
 	}
 
 	Fields struct {
 		// CPU
 		NumCpu       int   `json:"cpu.count"`
+		NumMaxProcs  int   `json:"cpu.maxprocs"`
 		NumGoroutine int   `json:"cpu.goroutines"`
 		NumCgoCall   int64 `json:"cpu.cgo_calls"`
 
+		NumGoroutineMin int `json:"cpu.goroutines.min"`
+		NumGoroutineMax int `json:"cpu.goroutines.max"`
+
 		// General
 		Alloc      int64 `json:"mem.alloc"`
 		TotalAlloc int64 `json:"mem.total"`
@@ -44,12 +235,13 @@ type (
 		Frees      int64 `json:"mem.frees"`
 
 		// Heap
-		HeapAlloc    int64 `json:"mem.heap.alloc"`
-		HeapSys      int64 `json:"mem.heap.sys"`
-		HeapIdle     int64 `json:"mem.heap.idle"`
-		HeapInuse    int64 `json:"mem.heap.inuse"`
-		HeapReleased int64 `json:"mem.heap.released"`
-		HeapObjects  int64 `json:"mem.heap.objects"`
+		HeapAlloc     int64 `json:"mem.heap.alloc"`
+		HeapSys       int64 `json:"mem.heap.sys"`
+		HeapIdle      int64 `json:"mem.heap.idle"`
+		HeapInuse     int64 `json:"mem.heap.inuse"`
+		HeapReleased  int64 `json:"mem.heap.released"`
+		HeapObjects   int64 `json:"mem.heap.objects"`
+		HeapAllocPeak int64 `json:"mem.heap.alloc_peak"`
 
 		// Stack
 		StackInuse  int64 `json:"mem.stack.inuse"`
@@ -67,14 +259,53 @@ type (
 		PauseTotalNs  int64   `json:"mem.gc.pause_total"`
 		PauseNs       int64   `json:"mem.gc.pause"`
 		NumGC         int32   `json:"mem.gc.count"`
+		NumForcedGC   int32   `json:"mem.gc.forced_count"`
 		GCCPUFraction float64 `json:"mem.gc.cpu_fraction"`
 
+		// Runtime
+		CollectDuration int64 `json:"runtime.collect.duration_ns"`
+
 		Goarch  string `json:"-"`
 		Goos    string `json:"-"`
 		Version string `json:"-"`
+
+		// Source is the backend the memory statistics were read from, SourceMemStats or
+		// SourceRuntimeMetrics.
+		Source string `json:"-"`
+
+		// Extra holds derived values, such as counter deltas, which are merged into Values.
+		Extra map[string]interface{} `json:"-"`
+
+		// goroutinesCreated is the cumulative count of created goroutines, when known.
+		goroutinesCreated int64
 	}
 )
 
+// Backends of the statistics, see Collector.Source.
+const (
+	SourceMemStats       = "memstats"
+	SourceRuntimeMetrics = "runtime_metrics"
+)
+
+// Source returns the backend the collector reads statistics from: SourceRuntimeMetrics
+// with EnableRuntimeMetrics, SourceMemStats otherwise.
+func (c *Collector) Source() string {
+	if c.EnableRuntimeMetrics {
+		return SourceRuntimeMetrics
+	}
+	return SourceMemStats
+}
+
+// Multiplex returns a CollectStatsCallback passing the same Fields to every callback
+// in order, so several exporters share one collection loop.
+func Multiplex(callbacks ...CollectStatsCallback) CollectStatsCallback {
+	return func(fields Fields) {
+		for _, callback := range callbacks {
+			callback(fields)
+		}
+	}
+}
+
 // New creates a new Collector that will periodically output statistics to collectStatsCallback. It
 // will also set the values of the exported fields to the described defaults. The values
 // of the exported defaults can be changed at any point before Run is called.
@@ -87,79 +318,320 @@ func New(callback CollectStatsCallback) *Collector {
 		PauseDur:             10 * time.Second,
 		EnableCPU:            true,
 		EnableMem:            true,
+		ProcessReadTimeout:   time.Second,
+		clock:                realClock{},
+		readMemStats:         runtime.ReadMemStats,
+		numGoroutine:         runtime.NumGoroutine,
+		readRuntimeMetrics:   readRuntimeMetrics,
+		readHistogram:        readHistogram,
+		readCPUTime:          processCPUTime,
+		procReader:           newProcReader(),
+		fdReader:             newFDReader(),
 		collectStatsCallback: callback,
 	}
 }
 
+// setDefaults sets the dependencies which New sets but a Collector built as a literal
+// lacks.
+func (c *Collector) setDefaults() {
+	c.defaultsOnce.Do(func() {
+		if c.readMemStats == nil {
+			c.readMemStats = runtime.ReadMemStats
+		}
+		if c.numGoroutine == nil {
+			c.numGoroutine = runtime.NumGoroutine
+		}
+		if c.readRuntimeMetrics == nil {
+			c.readRuntimeMetrics = readRuntimeMetrics
+		}
+		if c.readHistogram == nil {
+			c.readHistogram = readHistogram
+		}
+		if c.readCPUTime == nil {
+			c.readCPUTime = processCPUTime
+		}
+		if c.procReader == nil {
+			c.procReader = newProcReader()
+		}
+		if c.fdReader == nil {
+			c.fdReader = newFDReader()
+		}
+		if c.ProcessReadTimeout <= 0 {
+			c.ProcessReadTimeout = time.Second
+		}
+	})
+}
+
+// AddCallback registers another callback receiving every collected Fields, after the
+// one passed to New. It is safe to call while the collector runs, the callback then
+// receives the statistics from the next collection on.
+func (c *Collector) AddCallback(callback CollectStatsCallback) {
+	if callback == nil {
+		return
+	}
+
+	c.callbacksMu.Lock()
+	defer c.callbacksMu.Unlock()
+	// never append in place, collect iterates over a copy of the slice header
+	c.callbacks = append(c.callbacks[:len(c.callbacks):len(c.callbacks)], callback)
+}
+
 // Run gathers statistics then outputs them to the configured PointFunc every
 // PauseDur. Unlike OneOff, this function will return until Done has been closed
 // (or never if Done is nil), therefore it should be called in its own go routine.
 func (c *Collector) Run() {
-	c.collectStatsCallback(c.CollectStats())
-	tickCh := time.NewTicker(c.PauseDur).C
+	c.setDefaults()
+	if c.StartDelay > 0 {
+		delay := time.NewTimer(c.StartDelay)
+		select {
+		case <-c.Done:
+			delay.Stop()
+			return
+		case <-delay.C:
+		}
+	}
+
+	if c.GoroutineSampleInterval > 0 {
+		go c.sampleGoroutines()
+	}
+
+	var gcCh <-chan struct{}
+	if c.CollectOnGC {
+		gcCh = notifyGC(c.Done)
+	}
+
+	switch {
+	case c.TriggerOnly:
+		c.runTriggered(gcCh)
+		return
+	case c.CorrectDrift:
+		c.runDriftCorrected(gcCh)
+		return
+	}
+
+	trigger := c.Trigger
+	pause := c.collect()
+	ticker := time.NewTicker(pause)
+	defer func() { ticker.Stop() }()
 	for {
 		select {
 		case <-c.Done:
 			return
-		case <-tickCh:
-			c.collectStatsCallback(c.CollectStats())
+		case <-gcCh:
+			c.collect()
+		case _, ok := <-trigger:
+			if !ok {
+				trigger = nil
+				continue
+			}
+			c.collect()
+		case <-ticker.C:
+			if next := c.collect(); next != pause {
+				ticker.Stop()
+				pause = next
+				ticker = time.NewTicker(pause)
+			}
 		}
 	}
 }
 
+// collect outputs a set of statistics and returns the pause until the next one.
+func (c *Collector) collect() time.Duration {
+	if c.CollectIf != nil && !c.CollectIf() {
+		return c.currentPause()
+	}
+
+	fields := c.CollectStats()
+	c.collectStatsCallback(fields)
+
+	c.callbacksMu.Lock()
+	callbacks := c.callbacks
+	c.callbacksMu.Unlock()
+	for _, callback := range callbacks {
+		callback(fields)
+	}
+
+	return c.nextPause(fields, time.Now())
+}
+
 func (c *Collector) CollectStats() (fields Fields) {
+	c.setDefaults()
+	start := time.Now()
+
 	if c.EnableMem {
-		collectMemStats(&fields)
+		c.collectMemStats(&fields)
+		if c.EnableRuntimeMetrics {
+			c.collectRuntimeMetrics(&fields)
+		}
+	}
+
+	if c.EnableCgroupMem {
+		c.collectCgroupMem(&fields)
+	}
+
+	if c.EnableProcessMem {
+		c.collectProcessMem(&fields)
+	}
+
+	if c.EnableFDs {
+		c.collectFDs(&fields)
 	}
 
 	if c.EnableCPU {
 		collectCPUStats(&fields)
+		c.collectGoroutineRange(&fields)
+		c.checkGoroutineLimit(fields.NumGoroutine)
+		if c.EnableProcessCPU {
+			c.collectProcessCPU(&fields, time.Now())
+		}
+	}
+
+	if c.EnableSchedStats {
+		c.collectSchedStats(&fields)
+	}
+
+	// the wall time of reading the statistics, ReadMemStats stops the world
+	fields.CollectDuration = time.Since(start).Nanoseconds()
+	if c.SlowCollectThreshold > 0 {
+		fields.setExtra("runtime.collect.interval_ns", int64(c.currentPause()))
 	}
 
 	fields.Goos = runtime.GOOS
 	fields.Goarch = runtime.GOARCH
 	fields.Version = runtime.Version()
+	fields.Source = c.Source()
+
+	c.collectDeltas(&fields)
+	c.collectDerived(&fields, time.Now())
+
+	if c.EmitSeq {
+		c.mu.Lock()
+		c.seq++
+		fields.setExtra("seq", c.seq)
+		c.mu.Unlock()
+	}
 
 	return fields
 }
 
+func (c *Collector) checkGoroutineLimit(n int) {
+	if c.GoroutineLimit <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	crossed := n > c.GoroutineLimit && !c.overLimit
+	c.overLimit = n > c.GoroutineLimit
+	c.mu.Unlock()
+
+	if crossed && c.OnGoroutineLimit != nil {
+		c.OnGoroutineLimit(n)
+	}
+}
+
+func (c *Collector) collectDeltas(f *Fields) {
+	if len(c.CounterDeltas) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counters == nil {
+		c.counters = make(map[string]int64, len(c.CounterDeltas))
+	}
+
+	for key, v := range f.Select(c.CounterDeltas...) {
+		cur := toInt64(v)
+		if prev, ok := c.counters[key]; ok {
+			delta := cur - prev
+			if delta < 0 {
+				// the counter wrapped or was reset, count from zero
+				delta = cur
+			}
+			f.setExtra(key+"_delta", delta)
+		}
+		c.counters[key] = cur
+	}
+}
+
 func collectCPUStats(f *Fields) {
 	f.NumCpu = runtime.NumCPU()
+	f.NumMaxProcs = runtime.GOMAXPROCS(0)
 	f.NumGoroutine = runtime.NumGoroutine()
 	f.NumCgoCall = runtime.NumCgoCall()
 }
 
-func collectMemStats(f *Fields) {
-	m := &runtime.MemStats{}
-	runtime.ReadMemStats(m)
-	f.Alloc = int64(m.Alloc)
-	f.TotalAlloc = int64(m.TotalAlloc)
-	f.Sys = int64(m.Sys)
-	f.Lookups = int64(m.Lookups)
-	f.Mallocs = int64(m.Mallocs)
-	f.Frees = int64(m.Frees)
-	f.HeapAlloc = int64(m.HeapAlloc)
-	f.HeapSys = int64(m.HeapSys)
-	f.HeapIdle = int64(m.HeapIdle)
-	f.HeapInuse = int64(m.HeapInuse)
-	f.HeapReleased = int64(m.HeapReleased)
-	f.HeapObjects = int64(m.HeapObjects)
-	f.StackInuse = int64(m.StackInuse)
-	f.StackSys = int64(m.StackSys)
-	f.MSpanInuse = int64(m.MSpanInuse)
-	f.MSpanSys = int64(m.MSpanSys)
-	f.MCacheInuse = int64(m.MCacheInuse)
-	f.MCacheSys = int64(m.MCacheSys)
-	f.OtherSys = int64(m.OtherSys)
-	f.GCSys = int64(m.GCSys)
-	f.NextGC = int64(m.NextGC)
-	f.LastGC = int64(m.LastGC)
-	f.PauseTotalNs = int64(m.PauseTotalNs)
-	f.PauseNs = int64(m.PauseNs[(m.NumGC+255)%256])
+func (c *Collector) collectMemStats(f *Fields) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer func() {
+		if f.HeapAlloc > c.heapAllocPeak {
+			c.heapAllocPeak = f.HeapAlloc
+		}
+		f.HeapAllocPeak = c.heapAllocPeak
+	}()
+
+	m := c.lastMem
+	if !c.SkipMemStatsWhenBusy {
+		m = &runtime.MemStats{}
+		c.readMemStats(m)
+	} else {
+		stale := c.lastMem != nil && c.numGoroutine() > c.BusyGoroutines
+		if !stale {
+			m = &runtime.MemStats{}
+			c.readMemStats(m)
+			c.lastMem = m
+		}
+		f.setExtra("mem.stale", stale)
+	}
+
+	fillMemStats(f, m)
+	if c.GCPausePercentiles {
+		c.collectPausePercentiles(f, m)
+	}
+}
+
+// fillMemStats copies m into f. The unsigned MemStats values are clamped to the int64
+// range, so huge values are never reported as negative numbers.
+func fillMemStats(f *Fields, m *runtime.MemStats) {
+	f.Alloc = clampInt64(m.Alloc)
+	f.TotalAlloc = clampInt64(m.TotalAlloc)
+	f.Sys = clampInt64(m.Sys)
+	f.Lookups = clampInt64(m.Lookups)
+	f.Mallocs = clampInt64(m.Mallocs)
+	f.Frees = clampInt64(m.Frees)
+	f.HeapAlloc = clampInt64(m.HeapAlloc)
+	f.HeapSys = clampInt64(m.HeapSys)
+	f.HeapIdle = clampInt64(m.HeapIdle)
+	f.HeapInuse = clampInt64(m.HeapInuse)
+	f.HeapReleased = clampInt64(m.HeapReleased)
+	f.HeapObjects = clampInt64(m.HeapObjects)
+	f.StackInuse = clampInt64(m.StackInuse)
+	f.StackSys = clampInt64(m.StackSys)
+	f.MSpanInuse = clampInt64(m.MSpanInuse)
+	f.MSpanSys = clampInt64(m.MSpanSys)
+	f.MCacheInuse = clampInt64(m.MCacheInuse)
+	f.MCacheSys = clampInt64(m.MCacheSys)
+	f.OtherSys = clampInt64(m.OtherSys)
+	f.GCSys = clampInt64(m.GCSys)
+	f.NextGC = clampInt64(m.NextGC)
+	f.LastGC = clampInt64(m.LastGC)
+	f.PauseTotalNs = clampInt64(m.PauseTotalNs)
+	f.PauseNs = clampInt64(m.PauseNs[(m.NumGC+255)%256])
 	f.NumGC = int32(m.NumGC)
+	f.NumForcedGC = int32(m.NumForcedGC)
 	f.GCCPUFraction = m.GCCPUFraction
 }
 
+func clampInt64(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
+
 func (f *Fields) Tags() map[string]string {
 	return map[string]string{
 		"go.os":      f.Goos,
@@ -168,40 +640,158 @@ func (f *Fields) Tags() map[string]string {
 	}
 }
 
+// Values returns every metric value keyed by its dotted name. Integers are returned
+// as int64 whatever their Go type in Fields, so a value keeps the same type across
+// platforms and releases.
 func (f *Fields) Values() map[string]interface{} {
-	return map[string]interface{}{
-		"cpu.count":      f.NumCpu,
-		"cpu.goroutines": f.NumGoroutine,
-		"cpu.cgo_calls":  f.NumCgoCall,
-
-		"mem.alloc":   f.Alloc,
-		"mem.total":   f.TotalAlloc,
-		"mem.sys":     f.Sys,
-		"mem.lookups": f.Lookups,
-		"mem.malloc":  f.Mallocs,
-		"mem.frees":   f.Frees,
-
-		"mem.heap.alloc":    f.HeapAlloc,
-		"mem.heap.sys":      f.HeapSys,
-		"mem.heap.idle":     f.HeapIdle,
-		"mem.heap.inuse":    f.HeapInuse,
-		"mem.heap.released": f.HeapReleased,
-		"mem.heap.objects":  f.HeapObjects,
-
-		"mem.stack.inuse":        f.StackInuse,
-		"mem.stack.sys":          f.StackSys,
-		"mem.stack.mspan_inuse":  f.MSpanInuse,
-		"mem.stack.mspan_sys":    f.MSpanSys,
-		"mem.stack.mcache_inuse": f.MCacheInuse,
-		"mem.stack.mcache_sys":   f.MCacheSys,
-		"mem.othersys":           f.OtherSys,
-
-		"mem.gc.pause":        f.PauseNs,
-		"mem.gc.pause_total":  f.PauseTotalNs,
-		"mem.gc.sys":          f.GCSys,
-		"mem.gc.next":         f.NextGC,
-		"mem.gc.last":         f.LastGC,
-		"mem.gc.count":        f.NumGC,
-		"mem.gc.cpu_fraction": f.GCCPUFraction,
+	values := f.Select()
+	for k, v := range f.Extra {
+		values[k] = normalize(v)
+	}
+	return values
+}
+
+// Snapshot returns a flat, JSON-serializable object holding every value keyed as by
+// Values, converted to its registered field type, and the tags keyed as by Tags. Unlike
+// the json struct tags of Fields, its schema includes the derived and optional values
+// and only changes when values are added.
+func (f *Fields) Snapshot() map[string]interface{} {
+	values := f.Values()
+	snapshot := make(map[string]interface{}, len(values)+3)
+	for k, v := range values {
+		snapshot[k] = Typed(k, v)
+	}
+	for k, v := range f.Tags() {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// CPUValues returns the values of the "cpu" category.
+func (f *Fields) CPUValues() map[string]interface{} {
+	return f.CategoryValues("cpu")
+}
+
+// MemValues returns the values of the "mem" category.
+func (f *Fields) MemValues() map[string]interface{} {
+	return f.CategoryValues("mem")
+}
+
+// CategoryValues returns the values, including derived ones, belonging to category.
+func (f *Fields) CategoryValues(category string) map[string]interface{} {
+	values := f.Values()
+	for k := range values {
+		if Category(k) != category {
+			delete(values, k)
+		}
+	}
+	return values
+}
+
+func (f *Fields) setExtra(key string, value interface{}) {
+	if f.Extra == nil {
+		f.Extra = make(map[string]interface{})
+	}
+	f.Extra[key] = value
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint64:
+		return clampInt64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// normalize converts the integers of Fields to int64, other values are returned as is.
+func normalize(v interface{}) interface{} {
+	switch v.(type) {
+	case int, int32:
+		return toInt64(v)
+	}
+	return v
+}
+
+func toFloat64(v interface{}) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	return float64(toInt64(v))
+}
+
+// Select returns the values for the given dotted keys, as declared by the json
+// struct tags of Fields, with the integers as int64. Unknown keys are ignored. With no
+// keys, all values are returned.
+func (f *Fields) Select(keys ...string) map[string]interface{} {
+	v := reflect.ValueOf(f).Elem()
+
+	if len(keys) == 0 {
+		values := make(map[string]interface{}, len(metricFields))
+		for _, field := range metricFields {
+			values[field.key] = field.get(v.Field(field.index))
+		}
+		return values
+	}
+
+	values := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if i, ok := fieldIndex[key]; ok {
+			field := metricFields[i]
+			values[key] = field.get(v.Field(field.index))
+		}
+	}
+	return values
+}
+
+// Keys returns the dotted names of all metric values in declaration order.
+func Keys() []string {
+	return append([]string(nil), fieldKeys...)
+}
+
+// metricField is a metric value of Fields, whose accessor is resolved once from the
+// type of the struct field.
+type metricField struct {
+	key   string
+	index int
+	get   func(reflect.Value) interface{}
+}
+
+// metricFields are the metric values of Fields in declaration order, fieldIndex maps
+// their keys to their position in metricFields.
+var metricFields, fieldKeys, fieldIndex = indexFields()
+
+func indexFields() ([]metricField, []string, map[string]int) {
+	t := reflect.TypeOf(Fields{})
+	fields := make([]metricField, 0, t.NumField())
+	keys := make([]string, 0, t.NumField())
+	index := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		index[key] = len(fields)
+		fields = append(fields, metricField{key: key, index: i, get: fieldGetter(t.Field(i).Type)})
+		keys = append(keys, key)
+	}
+	return fields, keys, index
+}
+
+// fieldGetter returns the accessor of a struct field of type t, which returns the
+// signed integers as int64 like normalize.
+func fieldGetter(t reflect.Type) func(reflect.Value) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) interface{} { return v.Int() }
+	default:
+		return func(v reflect.Value) interface{} { return v.Interface() }
 	}
 }
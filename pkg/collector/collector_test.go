@@ -1,6 +1,16 @@
 package collector
 
 import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -33,6 +43,7 @@ func TestCollector(t *testing.T) {
 		"cpu.goroutines",
 		"mem.lookups",
 		"mem.gc.count",
+		"mem.gc.forced_count",
 	}
 
 	for _, fields := range latestFields {
@@ -48,3 +59,1113 @@ func TestCollector(t *testing.T) {
 		t.Errorf("num of points is lower than expected:\ngot: %d\nexp: %d", points, expected)
 	}
 }
+
+func TestValuesMatchStructTags(t *testing.T) {
+	f := Fields{
+		NumCpu: 1, NumMaxProcs: 34, NumGoroutine: 2, NumCgoCall: 3, NumGoroutineMin: 32, NumGoroutineMax: 33,
+		Alloc: 4, TotalAlloc: 5, Sys: 6, Lookups: 7, Mallocs: 8, Frees: 9,
+		HeapAlloc: 10, HeapSys: 11, HeapIdle: 12, HeapInuse: 13, HeapReleased: 14, HeapObjects: 15, HeapAllocPeak: 30,
+		StackInuse: 16, StackSys: 17, MSpanInuse: 18, MSpanSys: 19, MCacheInuse: 20, MCacheSys: 21, OtherSys: 22,
+		GCSys: 23, NextGC: 24, LastGC: 25, PauseTotalNs: 26, PauseNs: 27, NumGC: 28, NumForcedGC: 31, GCCPUFraction: 0.29,
+		CollectDuration: 35,
+	}
+
+	expected := map[string]interface{}{
+		"cpu.count":      int64(f.NumCpu),
+		"cpu.maxprocs":   int64(f.NumMaxProcs),
+		"cpu.goroutines": int64(f.NumGoroutine),
+		"cpu.cgo_calls":  f.NumCgoCall,
+
+		"cpu.goroutines.min": int64(f.NumGoroutineMin),
+		"cpu.goroutines.max": int64(f.NumGoroutineMax),
+
+		"mem.alloc":   f.Alloc,
+		"mem.total":   f.TotalAlloc,
+		"mem.sys":     f.Sys,
+		"mem.lookups": f.Lookups,
+		"mem.malloc":  f.Mallocs,
+		"mem.frees":   f.Frees,
+
+		"mem.heap.alloc":      f.HeapAlloc,
+		"mem.heap.sys":        f.HeapSys,
+		"mem.heap.idle":       f.HeapIdle,
+		"mem.heap.inuse":      f.HeapInuse,
+		"mem.heap.released":   f.HeapReleased,
+		"mem.heap.objects":    f.HeapObjects,
+		"mem.heap.alloc_peak": f.HeapAllocPeak,
+
+		"mem.stack.inuse":        f.StackInuse,
+		"mem.stack.sys":          f.StackSys,
+		"mem.stack.mspan_inuse":  f.MSpanInuse,
+		"mem.stack.mspan_sys":    f.MSpanSys,
+		"mem.stack.mcache_inuse": f.MCacheInuse,
+		"mem.stack.mcache_sys":   f.MCacheSys,
+		"mem.othersys":           f.OtherSys,
+
+		"mem.gc.pause":        f.PauseNs,
+		"mem.gc.pause_total":  f.PauseTotalNs,
+		"mem.gc.sys":          f.GCSys,
+		"mem.gc.next":         f.NextGC,
+		"mem.gc.last":         f.LastGC,
+		"mem.gc.count":        int64(f.NumGC),
+		"mem.gc.forced_count": int64(f.NumForcedGC),
+		"mem.gc.cpu_fraction": f.GCCPUFraction,
+
+		"runtime.collect.duration_ns": f.CollectDuration,
+	}
+
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("values derived from struct tags differ:\ngot: %v\nexp: %v", values, expected)
+	}
+
+	selected := f.Select("mem.heap.alloc", "mem.gc.pause", "unknown")
+	if len(selected) != 2 || selected["mem.heap.alloc"] != f.HeapAlloc || selected["mem.gc.pause"] != f.PauseNs {
+		t.Errorf("unexpected selection: %v", selected)
+	}
+}
+
+func TestCounterDeltas(t *testing.T) {
+	c := New(nil)
+	c.CounterDeltas = []string{"mem.malloc"}
+
+	first := c.CollectStats()
+	if _, ok := first.Values()["mem.malloc_delta"]; ok {
+		t.Error("delta must not be reported without a previous collection")
+	}
+
+	second := c.CollectStats()
+	values := second.Values()
+	if _, ok := values["mem.malloc"]; !ok {
+		t.Error("expected key (mem.malloc) not found")
+	}
+	delta, ok := values["mem.malloc_delta"]
+	if !ok {
+		t.Fatal("expected key (mem.malloc_delta) not found")
+	}
+	if exp := second.Mallocs - first.Mallocs; delta != exp {
+		t.Errorf("unexpected delta:\ngot: %v\nexp: %d", delta, exp)
+	}
+}
+
+func TestIdlePause(t *testing.T) {
+	c := New(nil)
+	c.PauseDur = time.Second
+	c.IdlePauseDur = time.Minute
+	c.IdleGoroutines = 2
+	c.IdleAllocRate = 1024
+
+	start := time.Unix(0, 0)
+	signal := []struct {
+		goroutines int
+		totalAlloc int64
+		exp        time.Duration
+	}{
+		{10, 0, time.Second},           // no baseline yet
+		{11, 512, time.Minute},         // stable goroutines, low allocation rate
+		{11, 1024, time.Minute},        // still idle
+		{40, 1024, time.Second},        // burst of goroutines
+		{40, 1 << 20, time.Second},     // heavy allocation
+		{39, 1<<20 + 100, time.Minute}, // quiet again
+	}
+
+	for i, s := range signal {
+		f := Fields{NumGoroutine: s.goroutines, TotalAlloc: s.totalAlloc}
+		if pause := c.nextPause(f, start.Add(time.Duration(i)*time.Second)); pause != s.exp {
+			t.Errorf("step %d: unexpected pause:\ngot: %s\nexp: %s", i, pause, s.exp)
+		}
+	}
+}
+
+func TestIdlePauseDefaultAllocRate(t *testing.T) {
+	c := New(nil)
+	c.PauseDur = time.Second
+	c.IdlePauseDur = time.Minute
+
+	start := time.Unix(0, 0)
+	signal := []struct {
+		totalAlloc int64
+		exp        time.Duration
+	}{
+		{0, time.Second},             // no baseline yet
+		{4 << 10, time.Minute},       // allocations of the collections alone
+		{4<<10 + 1<<20, time.Second}, // heavy allocation
+		{8<<10 + 1<<20, time.Minute}, // quiet again
+	}
+
+	for i, s := range signal {
+		f := Fields{NumGoroutine: 10, TotalAlloc: s.totalAlloc}
+		if pause := c.nextPause(f, start.Add(time.Duration(i)*time.Second)); pause != s.exp {
+			t.Errorf("step %d: unexpected pause:\ngot: %s\nexp: %s", i, pause, s.exp)
+		}
+	}
+}
+
+func TestCollectOnGC(t *testing.T) {
+	var mu sync.Mutex
+	var collections []Fields
+	c := New(func(f Fields) {
+		mu.Lock()
+		collections = append(collections, f)
+		mu.Unlock()
+	})
+	c.PauseDur = time.Hour
+	c.CollectOnGC = true
+
+	done := make(chan struct{})
+	collectorShutdown := make(chan struct{})
+	c.Done = done
+	go func() {
+		defer close(collectorShutdown)
+		c.Run()
+	}()
+
+	const gcs = 3
+	for i := 0; i < gcs; i++ {
+		time.Sleep(50 * time.Millisecond)
+		runtime.GC()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+	<-collectorShutdown
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp := 1 + gcs; len(collections) < exp {
+		t.Errorf("num of collections is lower than expected:\ngot: %d\nexp: %d", len(collections), exp)
+	}
+}
+
+// slowClock oversleeps every wait by lag.
+type slowClock struct {
+	mu  sync.Mutex
+	now time.Time
+	lag time.Duration
+}
+
+func (c *slowClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *slowClock) NewTimer(d time.Duration) timer {
+	t := &slowTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// slowTimer fires as soon as it is set, once its clock overslept the wait.
+type slowTimer struct {
+	clock *slowClock
+	ch    chan time.Time
+}
+
+func (t *slowTimer) C() <-chan time.Time { return t.ch }
+
+func (t *slowTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.now = t.clock.now.Add(d + t.clock.lag)
+	t.ch <- t.clock.now
+	return false
+}
+
+func (t *slowTimer) Stop() bool { return false }
+
+func TestCorrectDrift(t *testing.T) {
+	const collections = 50
+	clk := &slowClock{now: time.Unix(0, 0), lag: 30 * time.Millisecond}
+
+	var stamps []time.Time
+	done := make(chan struct{})
+	c := New(nil)
+	c.collectStatsCallback = func(Fields) {
+		if len(stamps) < collections {
+			stamps = append(stamps, clk.Now())
+			if len(stamps) == collections {
+				close(done)
+			}
+		}
+	}
+	c.PauseDur = 100 * time.Millisecond
+	c.CorrectDrift = true
+	c.clock = clk
+	c.Done = done
+	c.Run()
+
+	avg := stamps[len(stamps)-1].Sub(stamps[0]) / time.Duration(len(stamps)-1)
+	if diff := avg - c.PauseDur; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Errorf("average interval drifted:\ngot: %s\nexp: %s", avg, c.PauseDur)
+	}
+}
+
+func TestStartDelay(t *testing.T) {
+	var mu sync.Mutex
+	points := 0
+	c := New(func(Fields) {
+		mu.Lock()
+		points++
+		mu.Unlock()
+	})
+	c.PauseDur = 20 * time.Millisecond
+	c.StartDelay = 300 * time.Millisecond
+
+	done := make(chan struct{})
+	collectorShutdown := make(chan struct{})
+	c.Done = done
+	go func() {
+		defer close(collectorShutdown)
+		c.Run()
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	if points != 0 {
+		t.Errorf("expected no points during the start delay, got %d", points)
+	}
+	mu.Unlock()
+
+	time.Sleep(300 * time.Millisecond)
+	close(done)
+	<-collectorShutdown
+
+	mu.Lock()
+	defer mu.Unlock()
+	if points == 0 {
+		t.Error("expected points after the start delay")
+	}
+
+	// Done is respected while waiting
+	stopped := make(chan struct{})
+	c.Done = stopped
+	c.StartDelay = time.Hour
+	close(stopped)
+	c.Run()
+}
+
+func TestSeq(t *testing.T) {
+	c := New(nil)
+	c.EmitSeq = true
+	for exp := int64(1); exp <= 3; exp++ {
+		f := c.CollectStats()
+		if seq := f.Values()["seq"]; seq != exp {
+			t.Errorf("unexpected seq:\ngot: %v\nexp: %d", seq, exp)
+		}
+	}
+
+	restarted := New(nil)
+	restarted.EmitSeq = true
+	f := restarted.CollectStats()
+	if seq := f.Values()["seq"]; seq != int64(1) {
+		t.Errorf("expected seq to restart at 1, got %v", seq)
+	}
+
+	f = New(nil).CollectStats()
+	if _, ok := f.Values()["seq"]; ok {
+		t.Error("seq must not be reported unless enabled")
+	}
+}
+
+func TestGoroutineLimit(t *testing.T) {
+	var calls []int
+	c := New(nil)
+	c.GoroutineLimit = 100
+	c.OnGoroutineLimit = func(n int) { calls = append(calls, n) }
+
+	for _, n := range []int{50, 150, 200, 120, 90, 101, 300} {
+		c.checkGoroutineLimit(n)
+	}
+
+	if exp := []int{150, 101}; !reflect.DeepEqual(calls, exp) {
+		t.Errorf("unexpected callbacks:\ngot: %v\nexp: %v", calls, exp)
+	}
+}
+
+func TestDerived(t *testing.T) {
+	c := New(nil)
+	c.Derived = []string{"mem.heap.utilization", "mem.alloc_rate"}
+
+	first := c.CollectStats()
+	if _, ok := first.Values()["mem.alloc_rate"]; ok {
+		t.Error("rate must not be reported without a previous collection")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	second := c.CollectStats()
+	values := second.Values()
+	for _, name := range c.Derived {
+		if _, ok := values[name]; !ok {
+			t.Errorf("expected derived key (%s) not found", name)
+		}
+	}
+	for _, name := range DerivedNames() {
+		if _, ok := values[name]; ok && name != "mem.heap.utilization" && name != "mem.alloc_rate" {
+			t.Errorf("derived key (%s) reported without being listed", name)
+		}
+	}
+	if len(values) != len(Keys())+len(c.Derived) {
+		t.Errorf("unexpected number of values:\ngot: %d\nexp: %d", len(values), len(Keys())+len(c.Derived))
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	for _, triggerOnly := range []bool{true, false} {
+		points := make(chan Fields, 10)
+		c := New(func(f Fields) { points <- f })
+		c.PauseDur = time.Hour
+		trigger := make(chan struct{})
+		c.Trigger = trigger
+		c.TriggerOnly = triggerOnly
+
+		collectorShutdown := make(chan struct{})
+		done := make(chan struct{})
+		c.Done = done
+		go func() {
+			defer close(collectorShutdown)
+			c.Run()
+		}()
+
+		if !triggerOnly {
+			<-points // first periodic collection
+		}
+		for i := 0; i < 3; i++ {
+			trigger <- struct{}{}
+			select {
+			case <-points:
+			case <-time.After(time.Second):
+				t.Fatalf("no point produced for trigger %d (TriggerOnly: %t)", i, triggerOnly)
+			}
+		}
+
+		close(done)
+		<-collectorShutdown
+		if n := len(points); n != 0 {
+			t.Errorf("unexpected extra points (TriggerOnly: %t): %d", triggerOnly, n)
+		}
+	}
+}
+
+func TestCategoryValues(t *testing.T) {
+	f := New(nil).CollectStats()
+
+	expCPU := []string{"cpu.count", "cpu.maxprocs", "cpu.goroutines", "cpu.cgo_calls", "cpu.goroutines.min", "cpu.goroutines.max"}
+	cpu := f.CPUValues()
+	if len(cpu) != len(expCPU) {
+		t.Errorf("unexpected cpu keys: %v", cpu)
+	}
+	for _, key := range expCPU {
+		if _, ok := cpu[key]; !ok {
+			t.Errorf("expected key (%s) not found", key)
+		}
+	}
+
+	mem, rt := f.MemValues(), f.CategoryValues("runtime")
+	if len(mem)+len(cpu)+len(rt) != len(Keys()) {
+		t.Errorf("cpu, mem and runtime values don't cover all keys: %d + %d + %d != %d", len(cpu), len(mem), len(rt), len(Keys()))
+	}
+	for key := range mem {
+		if !strings.HasPrefix(key, "mem.") {
+			t.Errorf("unexpected key (%s) in mem values", key)
+		}
+	}
+}
+
+func TestHugeMemStatsNotNegative(t *testing.T) {
+	m := &runtime.MemStats{
+		Alloc:     math.MaxUint64,
+		HeapAlloc: math.MaxInt64 + 1,
+		HeapSys:   1 << 62,
+	}
+	f := &Fields{}
+	fillMemStats(f, m)
+
+	if f.Alloc != math.MaxInt64 || f.HeapAlloc != math.MaxInt64 {
+		t.Errorf("expected clamping to MaxInt64, got alloc=%d heap.alloc=%d", f.Alloc, f.HeapAlloc)
+	}
+	if f.HeapSys != 1<<62 {
+		t.Errorf("unexpected heap.sys:\ngot: %d\nexp: %d", f.HeapSys, int64(1<<62))
+	}
+	for key, v := range f.Values() {
+		if n, ok := v.(int64); ok && n < 0 {
+			t.Errorf("negative value for %s: %d", key, n)
+		}
+	}
+}
+
+func TestSkipMemStatsWhenBusy(t *testing.T) {
+	c := New(nil)
+	c.SkipMemStatsWhenBusy = true
+	c.BusyGoroutines = 100
+
+	reads, goroutines := 0, 10
+	c.readMemStats = func(m *runtime.MemStats) {
+		reads++
+		m.HeapAlloc = uint64(reads)
+	}
+	c.numGoroutine = func() int { return goroutines }
+
+	fields := c.CollectStats()
+	if reads != 1 || fields.Extra["mem.stale"] != false {
+		t.Fatalf("unexpected first collection:\ngot: reads=%d stale=%v\nexp: reads=1 stale=false", reads, fields.Extra["mem.stale"])
+	}
+
+	goroutines = 1000
+	fields = c.CollectStats()
+	if reads != 1 {
+		t.Errorf("ReadMemStats called while busy:\ngot: %d\nexp: 1", reads)
+	}
+	if fields.Extra["mem.stale"] != true || fields.HeapAlloc != 1 {
+		t.Errorf("unexpected busy collection:\ngot: stale=%v heap.alloc=%d\nexp: stale=true heap.alloc=1", fields.Extra["mem.stale"], fields.HeapAlloc)
+	}
+
+	goroutines = 10
+	fields = c.CollectStats()
+	if reads != 2 || fields.Extra["mem.stale"] != false || fields.HeapAlloc != 2 {
+		t.Errorf("unexpected collection after busy period:\ngot: reads=%d stale=%v heap.alloc=%d", reads, fields.Extra["mem.stale"], fields.HeapAlloc)
+	}
+}
+
+func TestRuntimeMetricsGCCycles(t *testing.T) {
+	c := New(nil)
+	if _, ok := c.CollectStats().Extra["mem.gc.cycles_total"]; ok {
+		t.Error("unexpected mem.gc.cycles_total without EnableRuntimeMetrics")
+	}
+
+	c.EnableRuntimeMetrics = true
+	c.readRuntimeMetrics = func() map[string]interface{} {
+		return map[string]interface{}{"mem.gc.cycles_total": uint64(1 << 40)}
+	}
+	if got := c.CollectStats().Extra["mem.gc.cycles_total"]; got != int64(1<<40) {
+		t.Errorf("unexpected mem.gc.cycles_total:\ngot: %v\nexp: %d", got, int64(1<<40))
+	}
+
+	c.readRuntimeMetrics = func() map[string]interface{} { return nil }
+	fields := c.CollectStats()
+	if got := fields.Extra["mem.gc.cycles_total"]; got != int64(fields.NumGC) {
+		t.Errorf("expected fallback to NumGC:\ngot: %v\nexp: %d", got, fields.NumGC)
+	}
+
+	runtime.GC()
+	if n, _ := readRuntimeMetrics()["mem.gc.cycles_total"].(uint64); n == 0 {
+		t.Errorf("unexpected runtime/metrics GC cycles: %d", n)
+	}
+}
+
+func TestRuntimeMetricsGCCPU(t *testing.T) {
+	c := New(nil)
+	c.EnableRuntimeMetrics = true
+	runtime.GC()
+	fields := c.CollectStats()
+
+	for _, key := range []string{"mem.gc.cpu.assist_seconds", "mem.gc.cpu.dedicated_seconds", "mem.gc.cpu.idle_seconds",
+		"mem.gc.cpu.pause_seconds", "mem.gc.cpu.total_seconds"} {
+		if _, ok := fields.Extra[key]; !ok {
+			t.Skipf("%s not supported by %s", key, runtime.Version())
+		}
+		v, ok := fields.Extra[key].(float64)
+		if !ok {
+			t.Errorf("expected float64 value for %s, got %#v", key, fields.Extra[key])
+			continue
+		}
+		if v < 0 {
+			t.Errorf("negative value for %s: %f", key, v)
+		}
+		if m, _ := Lookup(key); m.Type() != Float {
+			t.Errorf("expected %s to be written as a float", key)
+		}
+	}
+}
+
+func TestCollectIf(t *testing.T) {
+	points := 0
+	c := New(func(Fields) { points++ })
+	leader := false
+	c.CollectIf = func() bool { return leader }
+
+	for i, exp := range []int{0, 1, 2, 2, 3} {
+		leader = i%3 != 0
+		if pause := c.collect(); pause != c.PauseDur {
+			t.Errorf("unexpected pause:\ngot: %s\nexp: %s", pause, c.PauseDur)
+		}
+		if points != exp {
+			t.Errorf("unexpected number of collections after tick %d:\ngot: %d\nexp: %d", i, points, exp)
+		}
+	}
+}
+
+func TestGoroutineCreationRate(t *testing.T) {
+	c := New(nil)
+	c.Derived = []string{"cpu.goroutines_created_per_sec"}
+	created := uint64(100)
+	c.readRuntimeMetrics = func() map[string]interface{} {
+		return map[string]interface{}{"cpu.goroutines_created": created}
+	}
+
+	fields := Fields{}
+	start := time.Unix(0, 0)
+	c.collectDerived(&fields, start)
+	if _, ok := fields.Extra["cpu.goroutines_created_per_sec"]; ok {
+		t.Error("unexpected rate without a previous collection")
+	}
+
+	created += 500
+	fields = Fields{}
+	c.collectDerived(&fields, start.Add(2*time.Second))
+	if got := fields.Extra["cpu.goroutines_created_per_sec"]; got != 250.0 {
+		t.Errorf("unexpected creation rate:\ngot: %v\nexp: %v", got, 250.0)
+	}
+
+	c.readRuntimeMetrics = func() map[string]interface{} { return nil }
+	fields = Fields{}
+	c.collectDerived(&fields, start.Add(4*time.Second))
+	if _, ok := fields.Extra["cpu.goroutines_created_per_sec"]; ok {
+		t.Error("unexpected rate without a create counter")
+	}
+}
+
+func TestGoroutineCreationRateRuntimeMetrics(t *testing.T) {
+	if _, ok := readRuntimeMetrics()["cpu.goroutines_created"]; !ok {
+		t.Skipf("%s not supported by %s", runtimeMetrics["cpu.goroutines_created"], runtime.Version())
+	}
+
+	c := New(nil)
+	c.EnableRuntimeMetrics = true
+	c.Derived = []string{"cpu.goroutines_created_per_sec"}
+	first := c.CollectStats()
+	if _, ok := first.Extra["cpu.goroutines_created"].(int64); !ok {
+		t.Errorf("expected cpu.goroutines_created, got %#v", first.Extra["cpu.goroutines_created"])
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go wg.Done()
+	}
+	wg.Wait()
+	time.Sleep(time.Millisecond)
+
+	// without EnableRuntimeMetrics, the rate reads the counter itself
+	c.EnableRuntimeMetrics = false
+	second := c.CollectStats()
+	if rate, ok := second.Extra["cpu.goroutines_created_per_sec"].(float64); !ok || rate <= 0 {
+		t.Errorf("expected a positive creation rate, got %#v", second.Extra["cpu.goroutines_created_per_sec"])
+	}
+}
+
+func TestHeapAllocPeak(t *testing.T) {
+	c := New(nil)
+	heap := []uint64{10, 50, 30, 70, 20}
+	exp := []int64{10, 50, 50, 70, 70}
+	for i, v := range heap {
+		c.readMemStats = func(m *runtime.MemStats) { m.HeapAlloc = v }
+		if got := c.CollectStats().HeapAllocPeak; got != exp[i] {
+			t.Errorf("unexpected mem.heap.alloc_peak after %d:\ngot: %d\nexp: %d", v, got, exp[i])
+		}
+	}
+}
+
+func TestProcessReadTimeout(t *testing.T) {
+	c := New(nil)
+	c.ProcessReadTimeout = 20 * time.Millisecond
+
+	block, never := make(chan struct{}), make(chan struct{})
+	var reads int32
+	c.procReader.read = func(path string) ([]byte, error) {
+		if path == "/proc/self/never" {
+			<-never
+		}
+		n := atomic.AddInt32(&reads, 1)
+		if n > 1 {
+			<-block
+		}
+		return []byte(strconv.Itoa(int(n))), nil
+	}
+
+	data, stale, err := c.readProcFile("/proc/self/status")
+	if err != nil || stale || string(data) != "1" {
+		t.Fatalf("unexpected first read:\ngot: %q %v %v\nexp: \"1\" false <nil>", data, stale, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		data, stale, err = c.readProcFile("/proc/self/status")
+		if err != nil || !stale || string(data) != "1" {
+			t.Errorf("expected the last value on timeout:\ngot: %q %v %v\nexp: \"1\" true <nil>", data, stale, err)
+		}
+	}
+	if n := atomic.LoadInt32(&reads); n != 2 {
+		t.Errorf("expected a single read in flight:\ngot: %d reads\nexp: 2", n)
+	}
+
+	close(block)
+	data, stale, err = c.readProcFile("/proc/self/status")
+	if err != nil || stale || string(data) != "2" {
+		t.Errorf("unexpected read after the stall:\ngot: %q %v %v\nexp: \"2\" false <nil>", data, stale, err)
+	}
+
+	if _, stale, err := c.readProcFile("/proc/self/never"); err == nil || !stale {
+		t.Errorf("expected a timeout error without a previous value, got %v", err)
+	}
+}
+
+func TestAddCallback(t *testing.T) {
+	var first, second int64
+	c := New(func(Fields) { atomic.AddInt64(&first, 1) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.AddCallback(func(Fields) { atomic.AddInt64(&second, 1) })
+		}()
+	}
+	wg.Wait()
+	c.collect()
+
+	if first != 1 {
+		t.Errorf("unexpected calls of the New callback:\ngot: %d\nexp: %d", first, 1)
+	}
+	if second != 10 {
+		t.Errorf("unexpected calls of the added callbacks:\ngot: %d\nexp: %d", second, 10)
+	}
+}
+
+func TestForcedGCCount(t *testing.T) {
+	c := New(nil)
+	before := c.CollectStats().NumForcedGC
+	runtime.GC()
+	after := c.CollectStats()
+
+	if after.NumForcedGC != before+1 {
+		t.Errorf("unexpected forced GC count:\ngot: %d\nexp: %d", after.NumForcedGC, before+1)
+	}
+	if got := after.Values()["mem.gc.forced_count"]; got != int64(after.NumForcedGC) {
+		t.Errorf("unexpected mem.gc.forced_count value:\ngot: %v\nexp: %d", got, after.NumForcedGC)
+	}
+}
+
+func TestGoroutineSampling(t *testing.T) {
+	counts := make(chan int)
+	c := New(nil)
+	c.numGoroutine = func() int { return <-counts }
+	c.GoroutineSampleInterval = time.Millisecond
+	done := make(chan struct{})
+	defer close(done)
+	c.Done = done
+	go c.sampleGoroutines()
+
+	// a count is only received once the previous one is recorded
+	for _, n := range []int{1000, 1, 500} {
+		counts <- n
+	}
+
+	fields := c.CollectStats()
+	if fields.NumGoroutineMin != 1 || fields.NumGoroutineMax != 1000 {
+		t.Errorf("unexpected goroutine range:\ngot: %d-%d\nexp: %d-%d", fields.NumGoroutineMin, fields.NumGoroutineMax, 1, 1000)
+	}
+
+	fields = c.CollectStats()
+	if fields.NumGoroutineMin > fields.NumGoroutine || fields.NumGoroutineMax < fields.NumGoroutine || fields.NumGoroutineMax >= 1000 {
+		t.Errorf("expected a new window including the current count %d, got %d-%d",
+			fields.NumGoroutine, fields.NumGoroutineMin, fields.NumGoroutineMax)
+	}
+}
+
+func TestGCPausePercentiles(t *testing.T) {
+	m := &runtime.MemStats{}
+	c := New(nil)
+	c.GCPausePercentiles = true
+	c.readMemStats = func(dst *runtime.MemStats) { *dst = *m }
+
+	// 300 cycles of 1..300ns, of which the runtime only kept the last 256
+	for i := uint32(1); i <= 300; i++ {
+		m.PauseNs[(i+255)%256] = uint64(i)
+	}
+	m.NumGC = 300
+	f := c.CollectStats()
+	exp := map[string]int64{"mem.gc.pause.p50": 172, "mem.gc.pause.p90": 275, "mem.gc.pause.p99": 298, "mem.gc.pause.max": 300}
+	for key, v := range exp {
+		if got := f.Extra[key]; got != v {
+			t.Errorf("unexpected %s:\ngot: %v\nexp: %d", key, got, v)
+		}
+	}
+
+	f = c.CollectStats()
+	if _, ok := f.Extra["mem.gc.pause.max"]; ok {
+		t.Error("expected no percentiles without GC cycle")
+	}
+
+	m.PauseNs[(301+255)%256] = 1000
+	m.PauseNs[(302+255)%256] = 10
+	m.NumGC = 302
+	f = c.CollectStats()
+	if p50, max := f.Extra["mem.gc.pause.p50"], f.Extra["mem.gc.pause.max"]; p50 != int64(10) || max != int64(1000) {
+		t.Errorf("unexpected percentiles of the new pauses:\ngot: p50 %v, max %v\nexp: p50 10, max 1000", p50, max)
+	}
+}
+
+func TestRuntimeMetricsHistograms(t *testing.T) {
+	buckets := []float64{0, 1e-6, 1e-3, math.Inf(1)}
+	counts := []uint64{0, 0, 0}
+	c := New(nil)
+	c.EnableRuntimeMetrics = true
+	c.readRuntimeMetrics = func() map[string]interface{} {
+		return map[string]interface{}{
+			"mem.gc.pauses_seconds": &histogram{counts: append([]uint64(nil), counts...), buckets: buckets},
+		}
+	}
+
+	counts = []uint64{90, 9, 1}
+	fields := c.CollectStats()
+	exp := map[string]interface{}{"mem.gc.pauses_seconds.p50": 1e-6, "mem.gc.pauses_seconds.p90": 1e-6, "mem.gc.pauses_seconds.p99": 1e-3}
+	for key, v := range exp {
+		if got := fields.Extra[key]; got != v {
+			t.Errorf("unexpected %s on the first collection:\ngot: %v\nexp: %v", key, got, v)
+		}
+	}
+
+	fields = c.CollectStats()
+	if _, ok := fields.Extra["mem.gc.pauses_seconds.p50"]; ok {
+		t.Error("expected no percentiles without new observations")
+	}
+
+	counts = []uint64{90, 9, 3}
+	fields = c.CollectStats()
+	// the unbounded last bucket is reported at its lower boundary
+	if got := fields.Extra["mem.gc.pauses_seconds.p50"]; got != 1e-3 {
+		t.Errorf("unexpected percentile of the new observations:\ngot: %v\nexp: %v", got, 1e-3)
+	}
+}
+
+func TestSchedStats(t *testing.T) {
+	c := New(nil)
+	if _, ok := c.CollectStats().Extra["sched.latency.p50"]; ok {
+		t.Error("unexpected sched.latency.p50 without EnableSchedStats")
+	}
+
+	counts := []uint64{10, 0}
+	c.EnableSchedStats = true
+	c.readHistogram = func(name string) *histogram {
+		if name != schedLatencies {
+			t.Fatalf("unexpected histogram %s", name)
+		}
+		return &histogram{counts: append([]uint64(nil), counts...), buckets: []float64{0, 1e-6, 1e-3}}
+	}
+
+	// without baseline, the first collection covers the latencies since start
+	if got := c.CollectStats().Extra["sched.latency.p99"]; got != 1e-6 {
+		t.Errorf("unexpected first sched.latency.p99:\ngot: %v\nexp: %v", got, 1e-6)
+	}
+	counts = []uint64{10, 5}
+	if got := c.CollectStats().Extra["sched.latency.p50"]; got != 1e-3 {
+		t.Errorf("unexpected sched.latency.p50 since the previous collection:\ngot: %v\nexp: %v", got, 1e-3)
+	}
+
+	if readHistogram(schedLatencies) == nil {
+		t.Skipf("%s not supported by %s", schedLatencies, runtime.Version())
+	}
+}
+
+func TestMaxProcs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	fields := New(nil).CollectStats()
+	if fields.NumMaxProcs != 1 {
+		t.Errorf("unexpected cpu.maxprocs:\ngot: %d\nexp: %d", fields.NumMaxProcs, 1)
+	}
+	if got := fields.Values()["cpu.maxprocs"]; got != int64(1) {
+		t.Errorf("unexpected cpu.maxprocs value: %v", got)
+	}
+}
+
+func TestCgroupMem(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("cgroups are Linux-only")
+	}
+
+	for _, tt := range []struct {
+		name         string
+		files        map[string]string
+		limit, usage interface{}
+	}{
+		{"v2", map[string]string{"/sys/fs/cgroup/memory.max": "536870912\n", "/sys/fs/cgroup/memory.current": "1024\n"}, int64(536870912), int64(1024)},
+		{"v2 unlimited", map[string]string{"/sys/fs/cgroup/memory.max": "max\n", "/sys/fs/cgroup/memory.current": "1024\n"}, nil, int64(1024)},
+		{"v1", map[string]string{"/sys/fs/cgroup/memory/memory.limit_in_bytes": "2048\n", "/sys/fs/cgroup/memory/memory.usage_in_bytes": "512\n"}, int64(2048), int64(512)},
+		{"absent", map[string]string{}, nil, nil},
+	} {
+		c := New(nil)
+		c.EnableCgroupMem = true
+		c.procReader.read = func(path string) ([]byte, error) {
+			if data, ok := tt.files[path]; ok {
+				return []byte(data), nil
+			}
+			return nil, os.ErrNotExist
+		}
+
+		fields := c.CollectStats()
+		values := fields.Values()
+		if got := values["mem.cgroup.limit"]; got != tt.limit {
+			t.Errorf("%s: unexpected mem.cgroup.limit:\ngot: %v\nexp: %v", tt.name, got, tt.limit)
+		}
+		if got := values["mem.cgroup.usage"]; got != tt.usage {
+			t.Errorf("%s: unexpected mem.cgroup.usage:\ngot: %v\nexp: %v", tt.name, got, tt.usage)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := New(nil)
+	c.Derived = []string{"mem.heap.utilization"}
+	fields := c.CollectStats()
+
+	data, err := json.Marshal(fields.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	values := fields.Values()
+	if len(decoded) != len(values)+len(fields.Tags()) {
+		t.Errorf("unexpected number of keys:\ngot: %d\nexp: %d", len(decoded), len(values)+len(fields.Tags()))
+	}
+	if _, ok := decoded["mem.heap.utilization"]; !ok {
+		t.Error("expected the derived value in the snapshot")
+	}
+	if got := decoded["go.version"]; got != runtime.Version() {
+		t.Errorf("unexpected go.version:\ngot: %v\nexp: %s", got, runtime.Version())
+	}
+	if got := decoded["cpu.goroutines"].(json.Number).String(); got != strconv.Itoa(fields.NumGoroutine) {
+		t.Errorf("unexpected cpu.goroutines:\ngot: %s\nexp: %d", got, fields.NumGoroutine)
+	}
+
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("snapshot changed in the round-trip:\ngot: %s\nexp: %s", again, data)
+	}
+}
+
+func TestCollectDuration(t *testing.T) {
+	c := New(nil)
+	c.readMemStats = func(m *runtime.MemStats) {
+		time.Sleep(10 * time.Millisecond)
+		runtime.ReadMemStats(m)
+	}
+
+	fields := c.CollectStats()
+	if d := time.Duration(fields.CollectDuration); d < 10*time.Millisecond {
+		t.Errorf("expected the slow read in the collection duration, got %s", d)
+	}
+	if got := fields.CategoryValues("runtime"); len(got) != 1 {
+		t.Errorf("unexpected runtime values: %v", got)
+	}
+}
+
+func TestSlowCollectBackOff(t *testing.T) {
+	c := New(nil)
+	c.PauseDur = 10 * time.Millisecond
+	c.SlowCollectThreshold = time.Millisecond
+	c.MaxPauseDur = 50 * time.Millisecond
+
+	slow, fast := Fields{CollectDuration: int64(2 * time.Millisecond)}, Fields{}
+	steps := []struct {
+		fields Fields
+		exp    time.Duration
+	}{
+		{fast, 10 * time.Millisecond},
+		{slow, 20 * time.Millisecond},
+		{slow, 40 * time.Millisecond},
+		{slow, 50 * time.Millisecond},
+		{fast, 25 * time.Millisecond},
+		{fast, 12500 * time.Microsecond},
+		{fast, 10 * time.Millisecond},
+	}
+	for i, step := range steps {
+		if got := c.nextPause(step.fields, time.Now()); got != step.exp {
+			t.Errorf("unexpected pause after collection %d:\ngot: %s\nexp: %s", i, got, step.exp)
+		}
+	}
+
+	c.nextPause(slow, time.Now())
+	fields := c.CollectStats()
+	if got := fields.Values()["runtime.collect.interval_ns"]; got != int64(20*time.Millisecond) {
+		t.Errorf("unexpected runtime.collect.interval_ns:\ngot: %v\nexp: %d", got, int64(20*time.Millisecond))
+	}
+}
+
+func TestProcessCPU(t *testing.T) {
+	c := New(nil)
+	c.EnableProcessCPU = true
+	used := time.Duration(0)
+	c.readCPUTime = func() (time.Duration, bool) { return used, true }
+
+	start := time.Now()
+	var f Fields
+	c.collectProcessCPU(&f, start)
+	if _, ok := f.Extra["cpu.process.percent"]; ok {
+		t.Error("unexpected cpu.process.percent without a baseline")
+	}
+
+	used = 1500 * time.Millisecond
+	c.collectProcessCPU(&f, start.Add(time.Second))
+	if got := f.Extra["cpu.process.percent"]; got != 150.0 {
+		t.Errorf("unexpected cpu.process.percent:\ngot: %v\nexp: %v", got, 150.0)
+	}
+
+	c.readCPUTime = func() (time.Duration, bool) { return 0, false }
+	f = Fields{}
+	c.collectProcessCPU(&f, start.Add(2*time.Second))
+	if _, ok := f.Extra["cpu.process.percent"]; ok {
+		t.Error("unexpected cpu.process.percent without CPU time")
+	}
+}
+
+func TestProcessMem(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc/self/statm is Linux-only")
+	}
+
+	c := New(nil)
+	c.EnableProcessMem = true
+	c.procReader.read = func(path string) ([]byte, error) {
+		if path != "/proc/self/statm" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("300 200 50 10 0 100 0\n"), nil
+	}
+
+	fields := c.CollectStats()
+	pageSize := int64(os.Getpagesize())
+	if got := fields.Extra["mem.process.rss"]; got != 200*pageSize {
+		t.Errorf("unexpected mem.process.rss:\ngot: %v\nexp: %d", got, 200*pageSize)
+	}
+	if got := fields.Extra["mem.process.vsize"]; got != 300*pageSize {
+		t.Errorf("unexpected mem.process.vsize:\ngot: %v\nexp: %d", got, 300*pageSize)
+	}
+	if stale := fields.Extra["mem.process.stale"]; stale != false {
+		t.Errorf("unexpected mem.process.stale: %v", stale)
+	}
+
+	hung := make(chan struct{})
+	defer close(hung)
+	c.ProcessReadTimeout = 10 * time.Millisecond
+	c.procReader.read = func(string) ([]byte, error) {
+		<-hung
+		return nil, os.ErrNotExist
+	}
+	fields = c.CollectStats()
+	if got := fields.Extra["mem.process.rss"]; got != 200*pageSize || fields.Extra["mem.process.stale"] != true {
+		t.Errorf("expected the last values flagged as stale, got rss: %v, stale: %v", got, fields.Extra["mem.process.stale"])
+	}
+
+	c.procReader = newProcReader()
+	c.procReader.read = func(string) ([]byte, error) { return nil, os.ErrNotExist }
+	fields = c.CollectStats()
+	if _, ok := fields.Extra["mem.process.rss"]; ok {
+		t.Error("unexpected mem.process.rss without /proc")
+	}
+}
+
+func TestFDs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptors are only counted on Linux")
+	}
+
+	c := New(nil)
+	c.EnableFDs = true
+	before := c.CollectStats()
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	after := c.CollectStats()
+	open, ok := after.Extra["proc.open_fds"].(int64)
+	if !ok || open != before.Extra["proc.open_fds"].(int64)+1 {
+		t.Errorf("expected one more open descriptor:\ngot: %v\nexp: %v+1", after.Extra["proc.open_fds"], before.Extra["proc.open_fds"])
+	}
+	if max, ok := after.Extra["proc.max_fds"].(int64); !ok || max < open {
+		t.Errorf("unexpected proc.max_fds: %v", after.Extra["proc.max_fds"])
+	}
+	if stale := after.Extra["proc.fds.stale"]; stale != false {
+		t.Errorf("unexpected proc.fds.stale: %v", stale)
+	}
+
+	hung := make(chan struct{})
+	defer close(hung)
+	c.ProcessReadTimeout = 10 * time.Millisecond
+	c.fdReader.read = func(string) ([]byte, error) {
+		<-hung
+		return nil, os.ErrNotExist
+	}
+	fields := c.CollectStats()
+	if fields.Extra["proc.open_fds"] != open || fields.Extra["proc.fds.stale"] != true {
+		t.Errorf("expected the last count flagged as stale, got open_fds: %v, stale: %v",
+			fields.Extra["proc.open_fds"], fields.Extra["proc.fds.stale"])
+	}
+}
+
+func TestValuesIntegerTypes(t *testing.T) {
+	c := New(nil)
+	c.EmitSeq = true
+	fields := c.CollectStats()
+
+	for k, v := range fields.Values() {
+		switch v.(type) {
+		case int64, float64, bool:
+		default:
+			t.Errorf("unexpected type of %s: %T", k, v)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		key string
+		v   interface{}
+		exp string
+		ok  bool
+	}{
+		{"mem.gc.count", int32(3), "3", true},
+		{"mem.gc.cycles_total", uint64(math.MaxUint64), strconv.FormatInt(math.MaxInt64, 10), true},
+		{"mem.heap.utilization", 0.000001, "0.000001", true},
+		{"mem.stale", true, "1", true},
+		{"unknown", "text", "", false},
+	} {
+		if got, ok := FormatValue(tc.key, tc.v); got != tc.exp || ok != tc.ok {
+			t.Errorf("unexpected formatting of %s (%v):\ngot: %q, %v\nexp: %q, %v", tc.key, tc.v, got, ok, tc.exp, tc.ok)
+		}
+	}
+}
+
+func TestLiteralCollector(t *testing.T) {
+	c := &Collector{
+		EnableCPU:            true,
+		EnableMem:            true,
+		SkipMemStatsWhenBusy: true,
+		BusyGoroutines:       1 << 20,
+		EnableRuntimeMetrics: true,
+		EnableSchedStats:     true,
+		Derived:              []string{"cpu.goroutines_created_per_sec"},
+		EnableCgroupMem:      true,
+		EnableProcessCPU:     true,
+		EnableProcessMem:     true,
+		EnableFDs:            true,
+	}
+	if fields := c.CollectStats(); fields.NumGoroutine == 0 || fields.Sys == 0 {
+		t.Errorf("expected statistics from a Collector built as a literal, got %+v", fields)
+	}
+	if _, ok := c.CollectStats().Extra["proc.open_fds"]; !ok && runtime.GOOS == "linux" {
+		t.Error("expected proc.open_fds from a Collector built as a literal")
+	}
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// derivation computes a derived value from the current collection and, for rates,
+// the previous one. It reports false when the value can't be computed yet.
+type derivation func(cur, prev *Fields, elapsed time.Duration, now time.Time) (interface{}, bool)
+
+// derivations is the registry of derived values which can be enabled with
+// Collector.Derived. Their metadata is registered alongside the collected values.
+var derivations = map[string]derivation{
+	"mem.heap.utilization": func(cur, _ *Fields, _ time.Duration, _ time.Time) (interface{}, bool) {
+		if cur.HeapSys == 0 {
+			return nil, false
+		}
+		return float64(cur.HeapAlloc) / float64(cur.HeapSys), true
+	},
+	"mem.alloc_rate":    rate(func(f *Fields) int64 { return f.TotalAlloc }),
+	"mem.malloc_rate":   rate(func(f *Fields) int64 { return f.Mallocs }),
+	"mem.gc.rate":       rate(func(f *Fields) int64 { return int64(f.NumGC) }),
+	"cpu.cgo_call_rate": rate(func(f *Fields) int64 { return f.NumCgoCall }),
+	"cpu.goroutines_created_per_sec": func(cur, prev *Fields, elapsed time.Duration, now time.Time) (interface{}, bool) {
+		if cur.goroutinesCreated == 0 || prev == nil || prev.goroutinesCreated == 0 {
+			return nil, false
+		}
+		return rate(func(f *Fields) int64 { return f.goroutinesCreated })(cur, prev, elapsed, now)
+	},
+	"mem.gc.last_age": func(cur, _ *Fields, _ time.Duration, now time.Time) (interface{}, bool) {
+		if cur.LastGC == 0 {
+			return nil, false
+		}
+		return now.UnixNano() - cur.LastGC, true
+	},
+}
+
+func init() {
+	for _, m := range []Metadata{
+		{Key: "mem.heap.utilization", Kind: Gauge, Unit: unitFraction},
+		{Key: "mem.alloc_rate", Kind: Gauge, Unit: unitBytesPerSecond},
+		{Key: "mem.malloc_rate", Kind: Gauge, Unit: unitPerSecond},
+		{Key: "mem.gc.rate", Kind: Gauge, Unit: unitPerSecond},
+		{Key: "cpu.cgo_call_rate", Kind: Gauge, Unit: unitPerSecond},
+		{Key: "cpu.goroutines_created_per_sec", Kind: Gauge, Unit: unitPerSecond},
+		{Key: "mem.gc.last_age", Kind: Gauge, Unit: unitNanoseconds},
+	} {
+		m.Category = strings.SplitN(m.Key, ".", 2)[0]
+		registry[m.Key] = m
+	}
+}
+
+// rate derives the per second increase of a counter.
+func rate(counter func(*Fields) int64) derivation {
+	return func(cur, prev *Fields, elapsed time.Duration, _ time.Time) (interface{}, bool) {
+		if prev == nil || elapsed <= 0 {
+			return nil, false
+		}
+		delta := counter(cur) - counter(prev)
+		if delta < 0 {
+			return nil, false
+		}
+		return float64(delta) / elapsed.Seconds(), true
+	}
+}
+
+// IsDerived reports whether name is a derived value known to Collector.Derived, or
+// a "<counter>_delta" known to Collector.CounterDeltas.
+func IsDerived(name string) bool {
+	if _, ok := derivations[name]; ok {
+		return true
+	}
+	return strings.HasSuffix(name, "_delta") && IsCounter(strings.TrimSuffix(name, "_delta"))
+}
+
+// DerivedNames returns the names of the values available to Collector.Derived.
+func DerivedNames() []string {
+	names := make([]string, 0, len(derivations))
+	for name := range derivations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Collector) collectDerived(f *Fields, now time.Time) {
+	if len(c.Derived) == 0 {
+		return
+	}
+
+	if f.goroutinesCreated == 0 {
+		for _, name := range c.Derived {
+			if name == "cpu.goroutines_created_per_sec" {
+				f.setGoroutinesCreated(c.readRuntimeMetrics())
+				break
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var elapsed time.Duration
+	if c.prev != nil {
+		elapsed = now.Sub(c.prevAt)
+	}
+	for _, name := range c.Derived {
+		if derive, ok := derivations[name]; ok {
+			if v, ok := derive(f, c.prev, elapsed, now); ok {
+				f.setExtra(name, v)
+			}
+		}
+	}
+
+	prev := *f
+	prev.Extra = nil
+	c.prev, c.prevAt = &prev, now
+}
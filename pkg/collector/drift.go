@@ -0,0 +1,77 @@
+package collector
+
+import "time"
+
+type (
+	// clock abstracts time so the drift corrected loop can be tested.
+	clock interface {
+		Now() time.Time
+		NewTimer(d time.Duration) timer
+	}
+
+	// timer is the part of time.Timer used by the drift corrected loop.
+	timer interface {
+		C() <-chan time.Time
+		Reset(d time.Duration) bool
+		Stop() bool
+	}
+
+	realClock struct{}
+	realTimer struct{ *time.Timer }
+)
+
+func (realClock) Now() time.Time                 { return time.Now() }
+func (realClock) NewTimer(d time.Duration) timer { return realTimer{time.NewTimer(d)} }
+func (t realTimer) C() <-chan time.Time          { return t.Timer.C }
+
+// runDriftCorrected is the Run loop used when CorrectDrift is set. Every collection
+// is due one pause after the previous due time rather than after the previous
+// collection, so late wake-ups don't add up. When falling behind by more than a
+// whole pause, the missed collections are skipped, like a time.Ticker does.
+func (c *Collector) runDriftCorrected(gcCh <-chan struct{}) {
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	trigger := c.Trigger
+	due := clk.Now()
+	pause := c.collect()
+	due = due.Add(pause)
+	wait := func() time.Duration {
+		if d := due.Sub(clk.Now()); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	// the collections on GC or trigger don't move the due time, so the timer is only
+	// reset once it fired
+	t := clk.NewTimer(wait())
+	defer t.Stop()
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-gcCh:
+			c.collect()
+		case _, ok := <-trigger:
+			if !ok {
+				trigger = nil
+				continue
+			}
+			c.collect()
+		case <-t.C():
+			now := clk.Now()
+			if next := c.collect(); next != pause {
+				pause = next
+				due = now
+			}
+			due = due.Add(pause)
+			if behind := now.Sub(due); behind > pause {
+				due = due.Add(behind.Truncate(pause))
+			}
+			t.Reset(wait())
+		}
+	}
+}
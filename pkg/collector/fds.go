@@ -0,0 +1,29 @@
+package collector
+
+import "strconv"
+
+// newFDReader returns a procReader counting the open file descriptors listed in a
+// directory, such as /proc/self/fd, instead of reading a file.
+func newFDReader() *procReader {
+	r := newProcReader()
+	r.read = countFDs
+	return r
+}
+
+// collectFDs reports the number of open file descriptors of the process,
+// "proc.open_fds", and their soft limit, "proc.max_fds", so a descriptor leak can be
+// caught before the limit is reached. Like the files of /proc, the descriptors are
+// listed within ProcessReadTimeout and "proc.fds.stale" tells whether the count comes
+// from a timed out listing. Both are omitted outside Linux.
+func (c *Collector) collectFDs(f *Fields) {
+	data, stale, err := c.fdReader.ReadFile("/proc/self/fd", c.ProcessReadTimeout)
+	if err == nil {
+		if n, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+			f.setExtra("proc.open_fds", n)
+			f.setExtra("proc.fds.stale", stale)
+		}
+	}
+	if n, ok := maxFDs(); ok {
+		f.setExtra("proc.max_fds", n)
+	}
+}
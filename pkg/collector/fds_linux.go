@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// countFDs counts the entries of dir, less the descriptor reading it, and returns the
+// count in decimal so it can be read with a procReader.
+func countFDs(dir string) ([]byte, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("collector: no file descriptor in " + dir)
+	}
+	return []byte(strconv.Itoa(len(names) - 1)), nil
+}
+
+// maxFDs returns the soft limit of open file descriptors.
+func maxFDs() (int64, bool) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, false
+	}
+	if limit.Cur > math.MaxInt64 {
+		return math.MaxInt64, true
+	}
+	return int64(limit.Cur), true
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package collector
+
+import "errors"
+
+// countFDs is only supported on Linux.
+func countFDs(string) ([]byte, error) {
+	return nil, errors.New("collector: counting file descriptors is only supported on Linux")
+}
+
+// maxFDs is only supported on Linux.
+func maxFDs() (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package collector
+
+import "runtime"
+
+// gcSentinel is an unreachable object whose finalizer runs once the garbage
+// collector has swept it. The pointer keeps it out of the tiny allocator, whose
+// objects are not guaranteed to be finalized.
+type gcSentinel struct {
+	_ *int
+}
+
+// notifyGC returns a channel receiving a value after every completed GC cycle
+// until done is closed. Notifications are dropped while one is still pending.
+func notifyGC(done <-chan struct{}) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	armGCSentinel(ch, done)
+	return ch
+}
+
+func armGCSentinel(ch chan struct{}, done <-chan struct{}) {
+	runtime.SetFinalizer(&gcSentinel{}, func(*gcSentinel) {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+		armGCSentinel(ch, done)
+	})
+}
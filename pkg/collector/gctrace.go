@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GCTrace represents a garbage collection cycle reported by GODEBUG=gctrace=1.
+type GCTrace struct {
+	// Num is the GC number, incremented at each GC.
+	Num int64
+
+	// Since is the time since the program start.
+	Since time.Duration
+
+	// CPUPercent is the percentage of time spent in GC since the program start.
+	CPUPercent int
+
+	// Pause is the stop-the-world time of the cycle: sweep termination plus mark termination.
+	Pause time.Duration
+
+	// HeapStart, HeapEnd and HeapLive are the heap size at GC start, at GC end and the
+	// live heap, in bytes.
+	HeapStart int64
+	HeapEnd   int64
+	HeapLive  int64
+
+	// HeapGoal is the goal heap size, in bytes.
+	HeapGoal int64
+
+	// Procs is the number of processors used.
+	Procs int
+
+	// Forced is set for cycles forced by runtime.GC() or debug.FreeOSMemory.
+	Forced bool
+}
+
+// gc 1 @0.012s 2%: 0.026+0.39+0.10 ms clock, 0.21+0.88/0.76/0+0.84 ms cpu, 4->4->0 MB, 5 MB goal, ..., 8 P (forced)
+var gcTraceLine = regexp.MustCompile(`^gc (\d+) @([\d.]+)s (\d+)%: ([\d.]+)\+[\d.]+\+([\d.]+) ms clock, .* ms cpu, (\d+)->(\d+)->(\d+) MB, (\d+) MB goal, .*?(\d+) P`)
+
+// ParseGCTrace parses a gctrace line. Lines of other formats are reported as not ok.
+func ParseGCTrace(line string) (t GCTrace, ok bool) {
+	m := gcTraceLine.FindStringSubmatch(line)
+	if m == nil {
+		return t, false
+	}
+
+	t.Num, _ = strconv.ParseInt(m[1], 10, 64)
+	since, _ := strconv.ParseFloat(m[2], 64)
+	t.Since = time.Duration(since * float64(time.Second))
+	t.CPUPercent, _ = strconv.Atoi(m[3])
+	sweepTerm, _ := strconv.ParseFloat(m[4], 64)
+	markTerm, _ := strconv.ParseFloat(m[5], 64)
+	t.Pause = time.Duration((sweepTerm + markTerm) * float64(time.Millisecond))
+	t.HeapStart = parseMB(m[6])
+	t.HeapEnd = parseMB(m[7])
+	t.HeapLive = parseMB(m[8])
+	t.HeapGoal = parseMB(m[9])
+	t.Procs, _ = strconv.Atoi(m[10])
+	t.Forced = strings.HasSuffix(strings.TrimSpace(line), "(forced)")
+	return t, true
+}
+
+// ReadGCTrace calls fn for every gctrace line read from r until it fails or reaches
+// EOF. Other lines, such as the application's own stderr output, are skipped.
+func ReadGCTrace(r io.Reader, fn func(GCTrace)) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if t, ok := ParseGCTrace(s.Text()); ok {
+			fn(t)
+		}
+	}
+	return s.Err()
+}
+
+func parseMB(s string) int64 {
+	mb, _ := strconv.ParseInt(s, 10, 64)
+	return mb << 20
+}
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGCTrace(t *testing.T) {
+	input := strings.Join([]string{
+		"gc 1 @0.012s 2%: 0.026+0.39+0.10 ms clock, 0.21+0.88/0.76/0+0.84 ms cpu, 4->4->0 MB, 5 MB goal, 8 P",
+		"some application output",
+		"gc 2 @1.500s 3%: 0.011+0.40+0.003 ms clock, 0.092+0.12/0.37/0.31+0.029 ms cpu, 12->13->6 MB, 14 MB goal, 0 MB stacks, 0 MB globals, 4 P (forced)",
+	}, "\n")
+
+	var traces []GCTrace
+	if err := ReadGCTrace(strings.NewReader(input), func(t GCTrace) { traces = append(traces, t) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 {
+		t.Fatalf("unexpected number of cycles:\ngot: %d\nexp: %d", len(traces), 2)
+	}
+
+	first := traces[0]
+	if first.Num != 1 || first.CPUPercent != 2 || first.Procs != 8 || first.Forced {
+		t.Errorf("unexpected first cycle: %+v", first)
+	}
+	if first.Pause != 126*time.Microsecond {
+		t.Errorf("unexpected pause:\ngot: %s\nexp: %s", first.Pause, 126*time.Microsecond)
+	}
+	if first.HeapStart != 4<<20 || first.HeapLive != 0 || first.HeapGoal != 5<<20 {
+		t.Errorf("unexpected heap sizes: %+v", first)
+	}
+
+	second := traces[1]
+	if !second.Forced || second.Since != 1500*time.Millisecond || second.HeapEnd != 13<<20 || second.HeapLive != 6<<20 || second.Procs != 4 {
+		t.Errorf("unexpected second cycle: %+v", second)
+	}
+}
@@ -0,0 +1,51 @@
+package collector
+
+import "time"
+
+// goroutineRange is the lowest and highest goroutine count sampled since the last
+// collection.
+type goroutineRange struct {
+	sampled  bool
+	min, max int
+}
+
+func (g *goroutineRange) add(n int) {
+	if !g.sampled || n < g.min {
+		g.min = n
+	}
+	if !g.sampled || n > g.max {
+		g.max = n
+	}
+	g.sampled = true
+}
+
+// sampleGoroutines samples the goroutine count every GoroutineSampleInterval until
+// Done is closed.
+func (c *Collector) sampleGoroutines() {
+	ticker := time.NewTicker(c.GoroutineSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Done:
+			return
+		case <-ticker.C:
+			n := c.numGoroutine()
+			c.mu.Lock()
+			c.goroutines.add(n)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// collectGoroutineRange reports the goroutine range of the collection window, which
+// includes the count of this collection, and starts a new window.
+func (c *Collector) collectGoroutineRange(f *Fields) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.goroutines.add(f.NumGoroutine)
+	f.NumGoroutineMin = c.goroutines.min
+	f.NumGoroutineMax = c.goroutines.max
+	c.goroutines = goroutineRange{}
+}
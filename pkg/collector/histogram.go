@@ -0,0 +1,106 @@
+package collector
+
+import "math"
+
+// runtimeHistograms maps the keys reported with EnableRuntimeMetrics to the names of
+// the runtime/metrics histograms they are read from. Each histogram is reported as the
+// "<key>.p50", "<key>.p90" and "<key>.p99" percentiles of the observations since the
+// previous collection, or since the process started on the first collection.
+var runtimeHistograms = map[string]string{
+	"mem.gc.pauses_seconds":         "/gc/pauses:seconds",
+	"mem.heap.allocs_by_size_bytes": "/gc/heap/allocs-by-size:bytes",
+}
+
+// schedLatencies is the runtime/metrics histogram read with EnableSchedStats.
+const schedLatencies = "/sched/latencies:seconds"
+
+var histogramPercentiles = []struct {
+	suffix string
+	p      float64
+}{
+	{".p50", 0.50},
+	{".p90", 0.90},
+	{".p99", 0.99},
+}
+
+// histogram is a cumulative runtime/metrics histogram: counts[i] observations fell in
+// [buckets[i], buckets[i+1]).
+type histogram struct {
+	counts  []uint64
+	buckets []float64
+}
+
+// sub returns the observations of h not in prev. When prev is nil or doesn't match h,
+// e.g. because the buckets changed, h is returned.
+func (h *histogram) sub(prev *histogram) *histogram {
+	if prev == nil || len(prev.counts) != len(h.counts) {
+		return h
+	}
+
+	delta := &histogram{counts: make([]uint64, len(h.counts)), buckets: h.buckets}
+	for i, n := range h.counts {
+		if n < prev.counts[i] {
+			return h
+		}
+		delta.counts[i] = n - prev.counts[i]
+	}
+	return delta
+}
+
+// percentile returns the upper boundary of the bucket holding the p-th observation,
+// or its lower boundary for the unbounded last bucket. It returns false without
+// observations.
+func (h *histogram) percentile(p float64) (float64, bool) {
+	var total uint64
+	for _, n := range h.counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	// nearest rank, counting from 1
+	rank := uint64(math.Ceil(p * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		if upper := h.buckets[i+1]; !math.IsInf(upper, 1) {
+			return upper, true
+		}
+		return h.buckets[i], true
+	}
+	return 0, false
+}
+
+// collectHistogram reports the percentiles of the observations of the histogram key
+// since the previous collection.
+func (c *Collector) collectHistogram(f *Fields, key string, h *histogram) {
+	c.mu.Lock()
+	if c.histograms == nil {
+		c.histograms = make(map[string]*histogram)
+	}
+	delta := h.sub(c.histograms[key])
+	c.histograms[key] = h
+	c.mu.Unlock()
+
+	for _, hp := range histogramPercentiles {
+		if v, ok := delta.percentile(hp.p); ok {
+			f.setExtra(key+hp.suffix, Typed(key+hp.suffix, v))
+		}
+	}
+}
+
+// collectSchedStats reports the percentiles of the scheduler latencies, the time
+// goroutines spent runnable before running, since the previous collection. The first
+// collection has no baseline and reports the latencies since the process started.
+func (c *Collector) collectSchedStats(f *Fields) {
+	if h := c.readHistogram(schedLatencies); h != nil {
+		c.collectHistogram(f, "sched.latency", h)
+	}
+}
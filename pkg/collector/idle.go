@@ -0,0 +1,71 @@
+package collector
+
+import "time"
+
+// defaultIdleAllocRate is the IdleAllocRate used when it isn't set, in bytes per second.
+const defaultIdleAllocRate = 64 << 10
+
+// activity is the state used to tell an idle process from an active one.
+type activity struct {
+	at         time.Time
+	goroutines int
+	totalAlloc int64
+	idle       bool
+}
+
+// nextPause returns IdlePauseDur when the statistics gathered at now show the process
+// idle since the previous collection and PauseDur otherwise, or the backed off pause
+// after slow collections when it is longer.
+func (c *Collector) nextPause(f Fields, now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.IdlePauseDur > 0 {
+		prev := c.activity
+		c.activity = activity{at: now, goroutines: f.NumGoroutine, totalAlloc: f.TotalAlloc}
+		if !prev.at.IsZero() {
+			allocRate := c.IdleAllocRate
+			if allocRate <= 0 {
+				allocRate = defaultIdleAllocRate
+			}
+			c.activity.idle = isIdle(prev, c.activity, c.IdleGoroutines, allocRate)
+		}
+	}
+	c.backOff(time.Duration(f.CollectDuration))
+
+	return c.pause()
+}
+
+// currentPause returns the pause chosen by the latest collection.
+func (c *Collector) currentPause() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pause()
+}
+
+// pause returns the pause chosen by the latest collection, c.mu must be held.
+func (c *Collector) pause() time.Duration {
+	pause := c.PauseDur
+	if c.IdlePauseDur > 0 && c.activity.idle {
+		pause = c.IdlePauseDur
+	}
+	if c.backoff > pause {
+		pause = c.backoff
+	}
+	return pause
+}
+
+func isIdle(prev, cur activity, goroutines int, allocRate float64) bool {
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return prev.idle
+	}
+
+	delta := cur.goroutines - prev.goroutines
+	if delta < 0 {
+		delta = -delta
+	}
+
+	return delta <= goroutines && float64(cur.totalAlloc-prev.totalAlloc)/elapsed <= allocRate
+}
@@ -0,0 +1,265 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+)
+
+type (
+	// Kind describes how a metric value evolves over time.
+	Kind int
+
+	// ValueType is the field type a value is written as to InfluxDB.
+	ValueType int
+
+	// Metadata describes a single metric value reported by Fields.
+	Metadata struct {
+		// Key is the dotted name of the value, e.g. "mem.heap.alloc".
+		Key string
+
+		// Kind tells whether the value is a cumulative Counter or a point-in-time Gauge.
+		Kind Kind
+
+		// Unit of the value: "bytes", "nanoseconds", "seconds", "fraction", "percent",
+		// "count", "per_second" or "bytes_per_second".
+		Unit string
+
+		// Category is the key prefix the value belongs to: "cpu", "mem", "sched", "proc"
+		// or "runtime".
+		Category string
+	}
+)
+
+const (
+	// Gauge is a value sampled at collection time which can go up and down.
+	Gauge Kind = iota
+
+	// Counter is a cumulative value which only increases over the process lifetime.
+	Counter
+)
+
+const (
+	// Integer values are written as signed 64-bit integers ("i" suffix).
+	Integer ValueType = iota
+
+	// Float values are written as 64-bit floats.
+	Float
+
+	// Boolean values are written as booleans. No registered key has this type, only
+	// unregistered boolean values do.
+	Boolean
+)
+
+const (
+	unitBytes       = "bytes"
+	unitNanoseconds = "nanoseconds"
+	unitSeconds     = "seconds"
+	unitFraction    = "fraction"
+	unitPercent     = "percent"
+	unitCount       = "count"
+
+	unitPerSecond      = "per_second"
+	unitBytesPerSecond = "bytes_per_second"
+)
+
+var registry = newRegistry(
+	Metadata{Key: "cpu.count", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "cpu.maxprocs", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "cpu.goroutines", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "cpu.goroutines.min", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "cpu.goroutines.max", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "cpu.cgo_calls", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "cpu.process.percent", Kind: Gauge, Unit: unitPercent},
+
+	Metadata{Key: "mem.alloc", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.total", Kind: Counter, Unit: unitBytes},
+	Metadata{Key: "mem.sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.lookups", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "mem.malloc", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "mem.frees", Kind: Counter, Unit: unitCount},
+
+	Metadata{Key: "mem.heap.alloc", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.idle", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.inuse", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.released", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.objects", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "mem.heap.alloc_peak", Kind: Gauge, Unit: unitBytes},
+
+	Metadata{Key: "mem.cgroup.limit", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.cgroup.usage", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.process.rss", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.process.vsize", Kind: Gauge, Unit: unitBytes},
+
+	Metadata{Key: "mem.stack.inuse", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.stack.sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.stack.mspan_inuse", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.stack.mspan_sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.stack.mcache_inuse", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.stack.mcache_sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.othersys", Kind: Gauge, Unit: unitBytes},
+
+	Metadata{Key: "mem.gc.sys", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.gc.next", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.gc.last", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause_total", Kind: Counter, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause.p50", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause.p90", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause.p99", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.pause.max", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "mem.gc.count", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "mem.gc.forced_count", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "mem.gc.cpu_fraction", Kind: Gauge, Unit: unitFraction},
+	Metadata{Key: "mem.gc.cycles_total", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "cpu.goroutines_created", Kind: Counter, Unit: unitCount},
+	Metadata{Key: "mem.gc.cpu.assist_seconds", Kind: Counter, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.cpu.dedicated_seconds", Kind: Counter, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.cpu.idle_seconds", Kind: Counter, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.cpu.pause_seconds", Kind: Counter, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.cpu.total_seconds", Kind: Counter, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.pauses_seconds.p50", Kind: Gauge, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.pauses_seconds.p90", Kind: Gauge, Unit: unitSeconds},
+	Metadata{Key: "mem.gc.pauses_seconds.p99", Kind: Gauge, Unit: unitSeconds},
+	Metadata{Key: "mem.heap.allocs_by_size_bytes.p50", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.allocs_by_size_bytes.p90", Kind: Gauge, Unit: unitBytes},
+	Metadata{Key: "mem.heap.allocs_by_size_bytes.p99", Kind: Gauge, Unit: unitBytes},
+
+	Metadata{Key: "sched.latency.p50", Kind: Gauge, Unit: unitSeconds},
+	Metadata{Key: "sched.latency.p90", Kind: Gauge, Unit: unitSeconds},
+	Metadata{Key: "sched.latency.p99", Kind: Gauge, Unit: unitSeconds},
+
+	Metadata{Key: "proc.open_fds", Kind: Gauge, Unit: unitCount},
+	Metadata{Key: "proc.max_fds", Kind: Gauge, Unit: unitCount},
+
+	Metadata{Key: "runtime.collect.duration_ns", Kind: Gauge, Unit: unitNanoseconds},
+	Metadata{Key: "runtime.collect.interval_ns", Kind: Gauge, Unit: unitNanoseconds},
+)
+
+func newRegistry(entries ...Metadata) map[string]Metadata {
+	r := make(map[string]Metadata, len(entries))
+	for _, m := range entries {
+		m.Category = strings.SplitN(m.Key, ".", 2)[0]
+		r[m.Key] = m
+	}
+	return r
+}
+
+// Lookup returns the metadata registered for the dotted key.
+func Lookup(key string) (Metadata, bool) {
+	m, ok := registry[key]
+	return m, ok
+}
+
+// IsCounter reports whether key is a registered cumulative counter.
+func IsCounter(key string) bool {
+	m, ok := registry[key]
+	return ok && m.Kind == Counter
+}
+
+// Category returns the category of the dotted key, which is its first segment.
+// Derived keys such as "mem.malloc_delta" belong to the category of their source.
+func Category(key string) string {
+	if m, ok := registry[key]; ok {
+		return m.Category
+	}
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// IsCategory reports whether category is used by any registered value.
+func IsCategory(category string) bool {
+	for _, m := range registry {
+		if m.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Type returns the field type of the value: fractions, percentages and rates are floats
+// and every other value, counters included, is a signed integer. Counters are clamped to
+// the int64 range, so existing fields keep their type and InfluxDB 1.x compatible
+// endpoints, which don't support unsigned integers, accept them.
+func (m Metadata) Type() ValueType {
+	switch {
+	case m.Unit == unitFraction || m.Unit == unitPercent || m.Unit == unitSeconds || m.Unit == unitPerSecond || m.Unit == unitBytesPerSecond:
+		return Float
+	default:
+		return Integer
+	}
+}
+
+// Typed converts v to the Go type matching the field type registered for key, so a
+// field is always written with the same type whatever its Go type in Fields.
+// Unregistered keys keep floats, booleans and strings as they are and integers as int64.
+func Typed(key string, v interface{}) interface{} {
+	m, ok := registry[key]
+	if !ok {
+		switch v.(type) {
+		case float64, bool, string:
+			return v
+		}
+		return toInt64(v)
+	}
+
+	switch m.Type() {
+	case Float:
+		return toFloat64(v)
+	default:
+		return toInt64(v)
+	}
+}
+
+// FormatValue formats v, converted with Typed, as a plain decimal number, for text
+// protocols without field types: floats are formatted without exponent and booleans as
+// 0 or 1. It reports false for the values which aren't numbers, such as strings.
+func FormatValue(key string, v interface{}) (string, bool) {
+	switch n := Typed(key, v).(type) {
+	case int64:
+		return strconv.FormatInt(n, 10), true
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64), true
+	case bool:
+		if n {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
+
+func (k Kind) String() string {
+	switch k {
+	case Counter:
+		return "counter"
+	default:
+		return "gauge"
+	}
+}
+
+// String returns "integer" or "float".
+func (t ValueType) String() string {
+	switch t {
+	case Float:
+		return "float"
+	case Boolean:
+		return "boolean"
+	default:
+		return "integer"
+	}
+}
+
+// TypeOf returns the field type of key, according to its metadata or, for unregistered
+// keys, to the Go type of v.
+func TypeOf(key string, v interface{}) ValueType {
+	if m, ok := registry[key]; ok {
+		return m.Type()
+	}
+	switch v.(type) {
+	case float64:
+		return Float
+	case bool:
+		return Boolean
+	}
+	return Integer
+}
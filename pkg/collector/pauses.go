@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"math"
+	"runtime"
+	"sort"
+)
+
+// pausePercentiles are the percentiles of the GC pauses reported with
+// GCPausePercentiles, keyed by their value name.
+var pausePercentiles = []struct {
+	key string
+	p   float64
+}{
+	{"mem.gc.pause.p50", 0.50},
+	{"mem.gc.pause.p90", 0.90},
+	{"mem.gc.pause.p99", 0.99},
+	{"mem.gc.pause.max", 1},
+}
+
+// collectPausePercentiles reports the percentiles of the GC pauses of m which ended
+// since the previous collection. The runtime only keeps the last 256 pauses, older
+// ones are missed when more cycles ran between two collections. Nothing is reported
+// when no cycle ran. It must be called with c.mu held.
+func (c *Collector) collectPausePercentiles(f *Fields, m *runtime.MemStats) {
+	ring := uint32(len(m.PauseNs))
+	first := c.lastNumGC + 1
+	if m.NumGC >= ring && first <= m.NumGC-ring {
+		first = m.NumGC - ring + 1
+	}
+	c.lastNumGC = m.NumGC
+	if m.NumGC < first {
+		return
+	}
+
+	pauses := make([]uint64, 0, m.NumGC-first+1)
+	for i := first; i <= m.NumGC; i++ {
+		// the pause of cycle i, counting from 1
+		pauses = append(pauses, m.PauseNs[(i+ring-1)%ring])
+	}
+	sort.Slice(pauses, func(i, j int) bool { return pauses[i] < pauses[j] })
+
+	for _, pp := range pausePercentiles {
+		// nearest rank
+		rank := int(math.Ceil(pp.p*float64(len(pauses)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		f.setExtra(pp.key, clampInt64(pauses[rank]))
+	}
+}
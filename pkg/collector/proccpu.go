@@ -0,0 +1,23 @@
+package collector
+
+import "time"
+
+// collectProcessCPU reports the CPU time, user and system, the process used since the
+// previous collection as a percentage of the elapsed wall time, "cpu.process.percent".
+// It exceeds 100 when the process runs on several cores at once. The first collection
+// has no baseline and reports nothing, as do platforms without getrusage.
+func (c *Collector) collectProcessCPU(f *Fields, now time.Time) {
+	used, ok := c.readCPUTime()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	prev, prevAt := c.lastCPU, c.lastCPUAt
+	c.lastCPU, c.lastCPUAt = used, now
+	c.mu.Unlock()
+
+	if elapsed := now.Sub(prevAt); !prevAt.IsZero() && elapsed > 0 && used >= prev {
+		f.setExtra("cpu.process.percent", 100*float64(used-prev)/float64(elapsed))
+	}
+}
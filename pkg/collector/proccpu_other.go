@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package collector
+
+import "time"
+
+// processCPUTime is not supported without getrusage.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// collectProcessMem reports the resident set size and the virtual memory size of the
+// process, "mem.process.rss" and "mem.process.vsize" in bytes, read from
+// /proc/self/statm, and "mem.process.stale". Nothing is reported outside Linux or when
+// /proc is not mounted.
+func (c *Collector) collectProcessMem(f *Fields) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	data, stale, err := c.readProcFile("/proc/self/statm")
+	if err != nil {
+		return
+	}
+
+	// size resident shared text lib data dt, in pages
+	pages := strings.Fields(string(data))
+	if len(pages) < 2 {
+		return
+	}
+	size, err := strconv.ParseInt(pages[0], 10, 64)
+	if err != nil {
+		return
+	}
+	resident, err := strconv.ParseInt(pages[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	pageSize := int64(os.Getpagesize())
+	f.setExtra("mem.process.rss", resident*pageSize)
+	f.setExtra("mem.process.vsize", size*pageSize)
+	f.setExtra("mem.process.stale", stale)
+}
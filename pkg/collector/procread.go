@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+type (
+	// procReader reads process and OS files, such as those in /proc, with a timeout so
+	// a stalled filesystem never blocks the collection loop. At most one read per file
+	// is in flight: a hung read is awaited by the next collections instead of piling up
+	// goroutines, which get the last successfully read content meanwhile.
+	procReader struct {
+		read func(path string) ([]byte, error)
+
+		mu       sync.Mutex
+		last     map[string][]byte
+		inFlight map[string]chan procResult
+	}
+
+	procResult struct {
+		data []byte
+		err  error
+	}
+)
+
+func newProcReader() *procReader {
+	return &procReader{
+		read:     ioutil.ReadFile,
+		last:     make(map[string][]byte),
+		inFlight: make(map[string]chan procResult),
+	}
+}
+
+// ReadFile returns the content of path. When the read doesn't complete within
+// timeout, the content of the last successful read is returned with stale set, or an
+// error if there is none.
+func (r *procReader) ReadFile(path string, timeout time.Duration) (data []byte, stale bool, err error) {
+	r.mu.Lock()
+	ch, ok := r.inFlight[path]
+	if !ok {
+		ch = make(chan procResult, 1)
+		r.inFlight[path] = ch
+		go func() {
+			data, err := r.read(path)
+			ch <- procResult{data: data, err: err}
+		}()
+	}
+	r.mu.Unlock()
+
+	select {
+	case res := <-ch:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.inFlight, path)
+		if res.err != nil {
+			return nil, false, res.err
+		}
+		r.last[path] = res.data
+		return res.data, false, nil
+	case <-time.After(timeout):
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if last, ok := r.last[path]; ok {
+			return last, true, nil
+		}
+		return nil, true, fmt.Errorf("collector: reading %s timed out after %s", path, timeout)
+	}
+}
+
+// readProcFile reads path within ProcessReadTimeout, see procReader.ReadFile.
+func (c *Collector) readProcFile(path string) (data []byte, stale bool, err error) {
+	return c.procReader.ReadFile(path, c.ProcessReadTimeout)
+}
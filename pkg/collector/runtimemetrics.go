@@ -0,0 +1,44 @@
+package collector
+
+// runtimeMetrics maps the keys reported with EnableRuntimeMetrics to the names of the
+// runtime/metrics samples they are read from. Samples unsupported by the running Go
+// version are skipped.
+var runtimeMetrics = map[string]string{
+	"mem.gc.cycles_total":          "/gc/cycles/total:gc-cycles",
+	"cpu.goroutines_created":       "/sched/goroutines-created:goroutines",
+	"mem.gc.cpu.assist_seconds":    "/cpu/classes/gc/mark/assist:cpu-seconds",
+	"mem.gc.cpu.dedicated_seconds": "/cpu/classes/gc/mark/dedicated:cpu-seconds",
+	"mem.gc.cpu.idle_seconds":      "/cpu/classes/gc/mark/idle:cpu-seconds",
+	"mem.gc.cpu.pause_seconds":     "/cpu/classes/gc/pause:cpu-seconds",
+	"mem.gc.cpu.total_seconds":     "/cpu/classes/gc/total:cpu-seconds",
+}
+
+// collectRuntimeMetrics adds the values of the runtime/metrics package, falling back
+// to the MemStats values already in f when unavailable.
+func (c *Collector) collectRuntimeMetrics(f *Fields) {
+	values := c.readRuntimeMetrics()
+	for key, v := range values {
+		switch n := v.(type) {
+		case uint64:
+			f.setExtra(key, clampInt64(n))
+		case float64:
+			f.setExtra(key, n)
+		case *histogram:
+			c.collectHistogram(f, key, n)
+		}
+	}
+
+	f.setGoroutinesCreated(values)
+
+	if _, ok := values["mem.gc.cycles_total"]; !ok {
+		f.setExtra("mem.gc.cycles_total", int64(uint32(f.NumGC)))
+	}
+}
+
+// setGoroutinesCreated keeps the cumulative count of created goroutines in values for
+// the derivation of the creation rate.
+func (f *Fields) setGoroutinesCreated(values map[string]interface{}) {
+	if n, ok := values["cpu.goroutines_created"].(uint64); ok {
+		f.goroutinesCreated = clampInt64(n)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build go1.16
+// +build go1.16
+
+package collector
+
+import "runtime/metrics"
+
+// supportedRuntimeMetrics holds the keys of runtimeMetrics and runtimeHistograms
+// supported by the runtime.
+var supportedRuntimeMetrics = func() map[string]string {
+	names := make(map[string]bool)
+	for _, d := range metrics.All() {
+		names[d.Name] = true
+	}
+
+	supported := make(map[string]string, len(runtimeMetrics)+len(runtimeHistograms))
+	for _, m := range []map[string]string{runtimeMetrics, runtimeHistograms} {
+		for key, name := range m {
+			if names[name] {
+				supported[key] = name
+			}
+		}
+	}
+	return supported
+}()
+
+// readRuntimeMetrics reads the supported runtimeMetrics and runtimeHistograms, as
+// uint64, float64 or *histogram values.
+func readRuntimeMetrics() map[string]interface{} {
+	keys := make([]string, 0, len(supportedRuntimeMetrics))
+	samples := make([]metrics.Sample, 0, len(supportedRuntimeMetrics))
+	for key, name := range supportedRuntimeMetrics {
+		keys = append(keys, key)
+		samples = append(samples, metrics.Sample{Name: name})
+	}
+	metrics.Read(samples)
+
+	values := make(map[string]interface{}, len(samples))
+	for i, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			values[keys[i]] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			values[keys[i]] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			values[keys[i]] = &histogram{counts: h.Counts, buckets: h.Buckets}
+		}
+	}
+	return values
+}
+
+// readHistogram reads the runtime/metrics histogram name, nil if unsupported.
+func readHistogram(name string) *histogram {
+	samples := []metrics.Sample{{Name: name}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	h := samples[0].Value.Float64Histogram()
+	return &histogram{counts: h.Counts, buckets: h.Buckets}
+}
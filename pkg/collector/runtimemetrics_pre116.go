@@ -0,0 +1,14 @@
+//go:build !go1.16
+// +build !go1.16
+
+package collector
+
+// readRuntimeMetrics returns no values, runtime/metrics is only available since Go 1.16.
+func readRuntimeMetrics() map[string]interface{} {
+	return nil
+}
+
+// readHistogram returns nil, runtime/metrics is only available since Go 1.16.
+func readHistogram(name string) *histogram {
+	return nil
+}
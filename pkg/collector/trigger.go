@@ -0,0 +1,25 @@
+package collector
+
+// runTriggered is the Run loop used when TriggerOnly is set. It returns when Done
+// is closed, or when Trigger is closed and there is no GC notification to wait for.
+func (c *Collector) runTriggered(gcCh <-chan struct{}) {
+	trigger := c.Trigger
+	for {
+		if trigger == nil && gcCh == nil {
+			return
+		}
+
+		select {
+		case <-c.Done:
+			return
+		case <-gcCh:
+			c.collect()
+		case _, ok := <-trigger:
+			if !ok {
+				trigger = nil
+				continue
+			}
+			c.collect()
+		}
+	}
+}
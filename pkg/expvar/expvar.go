@@ -7,8 +7,26 @@ import (
 	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
 )
 
-const defaultMeasurement = "go_runtime_metrics"
+const (
+	defaultMeasurement = "go_runtime_metrics"
+
+	// MeasurementEnv names the environment variable overriding the measurement.
+	MeasurementEnv = "GO_RUNTIME_METRICS_MEASUREMENT"
+
+	// KeyEnv names the environment variable overriding the key the variable is
+	// published under, os.Args[0] by default.
+	KeyEnv = "GO_RUNTIME_METRICS_EXPVAR_KEY"
+)
 
 func init() {
-	expvar.Publish(os.Args[0], influxdb.Metrics(defaultMeasurement))
+	measurement := os.Getenv(MeasurementEnv)
+	if measurement == "" {
+		measurement = defaultMeasurement
+	}
+	key := os.Getenv(KeyEnv)
+	if key == "" {
+		key = os.Args[0]
+	}
+
+	expvar.Publish(key, influxdb.Metrics(measurement))
 }
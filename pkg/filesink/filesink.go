@@ -0,0 +1,102 @@
+// Package filesink appends batches of points to a local file, optionally gzip
+// compressed, for exporters writing to disk such as lineprotocol.
+//
+//	f, err := filesink.Open("/var/log/app/runtime.lp", true)
+//	if err != nil {
+//		// handle error
+//	}
+//	defer f.Close()
+package filesink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"strings"
+	"sync"
+)
+
+const gzipExt = ".gz"
+
+// Sink is a file for exporters writing batches of points, optionally gzip compressed.
+// Each batch should be followed by Flush, so a reader or a crash never sees a torn
+// batch, and the Sink must be closed on shutdown to complete the gzip stream.
+// It is safe for concurrent use.
+type Sink struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+}
+
+// Open opens path for appending, creating it if needed. With compress, ".gz" is
+// appended to path unless already present and the output is gzip compressed;
+// appending to an existing compressed file adds a new gzip member, which readers
+// decompress transparently.
+func Open(path string, compress bool) (*Sink, error) {
+	if compress && !strings.HasSuffix(path, gzipExt) {
+		path += gzipExt
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sink{file: file, buf: bufio.NewWriter(file)}
+	if compress {
+		s.gz = gzip.NewWriter(s.buf)
+	}
+	return s, nil
+}
+
+// Name returns the path of the file, including the ".gz" extension when compressed.
+func (s *Sink) Name() string {
+	return s.file.Name()
+}
+
+// Write writes p to the file. Data is buffered until Flush or Close.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gz != nil {
+		return s.gz.Write(p)
+	}
+	return s.buf.Write(p)
+}
+
+// Flush writes the buffered data, including pending compressed blocks, to the file.
+func (s *Sink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flush()
+}
+
+func (s *Sink) flush() error {
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return s.buf.Flush()
+}
+
+// Close completes the gzip stream, flushes and closes the file.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.gz != nil {
+		err = s.gz.Close()
+	}
+	if ferr := s.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
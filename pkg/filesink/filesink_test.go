@@ -0,0 +1,70 @@
+package filesink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	batches := []string{
+		"go.runtime,go.os=linux cpu.goroutines=5i 1\n",
+		"go.runtime,go.os=linux cpu.goroutines=7i 2\n",
+	}
+
+	s, err := Open(filepath.Join(dir, "metrics.lp"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(s.Name(), ".lp.gz") {
+		t.Errorf("expected .gz extension, got %s", s.Name())
+	}
+
+	for _, batch := range batches {
+		if _, err := s.Write([]byte(batch)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// flushed batches are readable before Close
+	if got := readGzip(t, s.Name(), false); got != strings.Join(batches, "") {
+		t.Errorf("unexpected content after flush:\ngot: %q\nexp: %q", got, strings.Join(batches, ""))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readGzip(t, s.Name(), true); got != strings.Join(batches, "") {
+		t.Errorf("unexpected content after close:\ngot: %q\nexp: %q", got, strings.Join(batches, ""))
+	}
+}
+
+func readGzip(t *testing.T, path string, complete bool) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if complete && err != nil {
+		t.Fatalf("truncated gzip stream: %v", err)
+	}
+	return string(content)
+}
@@ -0,0 +1,74 @@
+package history
+
+import (
+	"sync"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+// History keeps the last collections in a fixed size ring buffer so in-process
+// dashboards or debug endpoints can show a short history without a TSDB.
+// It is safe for concurrent use.
+//
+//	h := history.New(60)
+//	c := collector.New(h.Add)
+//	go c.Run()
+//	...
+//	last := h.Recent(10)
+type History struct {
+	mu    sync.RWMutex
+	buf   []collector.Fields
+	next  int
+	count int
+}
+
+// New creates a History holding at most size collections. A size below 1 is treated as 1.
+func New(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{buf: make([]collector.Fields, size)}
+}
+
+// Add stores fields, evicting the oldest collection when the buffer is full.
+// Its signature matches collector.CollectStatsCallback.
+func (h *History) Add(fields collector.Fields) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buf[h.next] = fields
+	h.next = (h.next + 1) % len(h.buf)
+	if h.count < len(h.buf) {
+		h.count++
+	}
+}
+
+// Recent returns up to the n latest collections, oldest first.
+func (h *History) Recent(n int) []collector.Fields {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if n > h.count {
+		n = h.count
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	recent := make([]collector.Fields, n)
+	start := h.next - n
+	if start < 0 {
+		start += len(h.buf)
+	}
+	for i := range recent {
+		recent[i] = h.buf[(start+i)%len(h.buf)]
+	}
+	return recent
+}
+
+// Len returns the number of collections currently held.
+func (h *History) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count
+}
@@ -0,0 +1,37 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+func TestHistory(t *testing.T) {
+	h := New(3)
+	if recent := h.Recent(3); len(recent) != 0 {
+		t.Errorf("expected empty history, got %d entries", len(recent))
+	}
+
+	for i := 1; i <= 5; i++ {
+		h.Add(collector.Fields{NumGoroutine: i})
+	}
+
+	if h.Len() != 3 {
+		t.Errorf("unexpected length:\ngot: %d\nexp: %d", h.Len(), 3)
+	}
+
+	recent := h.Recent(10)
+	exp := []int{3, 4, 5}
+	if len(recent) != len(exp) {
+		t.Fatalf("unexpected number of entries:\ngot: %d\nexp: %d", len(recent), len(exp))
+	}
+	for i, f := range recent {
+		if f.NumGoroutine != exp[i] {
+			t.Errorf("entry %d: got (%d) exp (%d)", i, f.NumGoroutine, exp[i])
+		}
+	}
+
+	if last := h.Recent(1); len(last) != 1 || last[0].NumGoroutine != 5 {
+		t.Errorf("expected the latest entry, got %v", last)
+	}
+}
@@ -0,0 +1,79 @@
+package httpjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+)
+
+// MaxBodySize is the maximum size in bytes of a batch accepted by Receiver.
+const MaxBodySize = 1 << 20
+
+// PointCallback represents a callback invoked for every point accepted by Receiver
+type PointCallback func(influxdb.Point)
+
+// Receiver returns an http.Handler which accepts POSTed JSON batches of influxdb.Point
+// and invokes callback once per decoded point, in order. Use it to build custom
+// aggregation or re-export of runtime metrics without InfluxDB.
+//
+//	http.Handle("/ingest", httpjson.Receiver(func(p influxdb.Point) {
+//	    log.Println(p.Name, p.Values.NumGoroutine)
+//	}))
+//
+// The whole batch is validated before any callback runs; a malformed payload
+// results in 400 Bad Request and a batch larger than MaxBodySize in 413 Request Entity
+// Too Large, both without callbacks.
+func Receiver(callback PointCallback) http.Handler {
+	if callback == nil {
+		callback = func(influxdb.Point) {}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+		if err != nil {
+			// the reader fails once MaxBodySize bytes are read and more remain
+			if len(body) >= MaxBodySize {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("reading payload: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		points, err := decodePoints(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, p := range points {
+			callback(p)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func decodePoints(body []byte) ([]influxdb.Point, error) {
+	var points []influxdb.Point
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&points); err != nil {
+		return nil, fmt.Errorf("malformed payload: %v", err)
+	}
+
+	for i, p := range points {
+		if p.Name == "" {
+			return nil, fmt.Errorf("point %d: missing name", i)
+		}
+	}
+
+	return points, nil
+}
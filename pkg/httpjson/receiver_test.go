@@ -0,0 +1,86 @@
+package httpjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+)
+
+func TestReceiver(t *testing.T) {
+	batch := []influxdb.Point{
+		{Name: "first", Tags: map[string]string{"go.os": "linux"}, Values: collector.Fields{NumGoroutine: 3}},
+		{Name: "second", Tags: map[string]string{"go.os": "darwin"}, Values: collector.Fields{NumGoroutine: 7}},
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []influxdb.Point
+	h := Receiver(func(p influxdb.Point) {
+		received = append(received, p)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status:\ngot: %d\nexp: %d", rec.Code, http.StatusNoContent)
+	}
+	if len(received) != len(batch) {
+		t.Fatalf("unexpected number of points:\ngot: %d\nexp: %d", len(received), len(batch))
+	}
+	for i, p := range received {
+		if p.Name != batch[i].Name {
+			t.Errorf("expected name (%s) got (%s)", batch[i].Name, p.Name)
+		}
+		if p.Tags["go.os"] != batch[i].Tags["go.os"] {
+			t.Errorf("expected tag (%s) got (%s)", batch[i].Tags["go.os"], p.Tags["go.os"])
+		}
+		if p.Values.NumGoroutine != batch[i].Values.NumGoroutine {
+			t.Errorf("expected goroutines (%d) got (%d)", batch[i].Values.NumGoroutine, p.Values.NumGoroutine)
+		}
+	}
+}
+
+func TestReceiverMalformed(t *testing.T) {
+	called := false
+	h := Receiver(func(influxdb.Point) {
+		called = true
+	})
+
+	for _, body := range []string{`{"name":`, `[{"name":"ok"},{"tags":{}}]`} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status for %q:\ngot: %d\nexp: %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	if called {
+		t.Error("callback must not be invoked for malformed payloads")
+	}
+}
+
+func TestReceiverTooLarge(t *testing.T) {
+	called := false
+	h := Receiver(func(influxdb.Point) {
+		called = true
+	})
+
+	body := `[{"name":"` + strings.Repeat("x", MaxBodySize) + `"}]`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status:\ngot: %d\nexp: %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if called {
+		t.Error("callback must not be invoked for oversized payloads")
+	}
+}
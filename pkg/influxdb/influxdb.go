@@ -1,11 +1,50 @@
 package influxdb
 
 import (
+	"encoding/json"
 	"expvar"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
 )
 
+// collectStats gathers the statistics published by the expvar funcs.
+var collectStats = func() collector.Fields {
+	return collector.New(nil).CollectStats()
+}
+
+// safe returns an expvar.Func calling f which survives a panic of f, returning the
+// last value f returned instead, or an error object when f never succeeded.
+func safe(f func() interface{}) expvar.Func {
+	var (
+		mu   sync.Mutex
+		last interface{}
+	)
+	return func() (v interface{}) {
+		defer func() {
+			if r := recover(); r != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if last != nil {
+					v = last
+				} else {
+					v = map[string]string{"error": fmt.Sprintf("collecting runtime metrics: %v", r)}
+				}
+			}
+		}()
+
+		v = f()
+		mu.Lock()
+		last = v
+		mu.Unlock()
+		return v
+	}
+}
+
 // Point A structure compatible with Telegraf's InfluxDB input plugin format
 // https://github.com/influxdata/telegraf/tree/master/plugins/inputs/influxdb
 type Point struct {
@@ -14,6 +53,66 @@ type Point struct {
 	Values collector.Fields  `json:"values"`
 }
 
+// VerbosePoint A Point carrying the unit and type of every value, for consumers
+// which need to know e.g. that mem.alloc is a gauge in bytes
+type VerbosePoint struct {
+	Name   string                  `json:"name"`
+	Tags   map[string]string       `json:"tags"`
+	Values map[string]VerboseValue `json:"values"`
+}
+
+// VerboseValue A single value with its metadata
+type VerboseValue struct {
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit,omitempty"`
+	Type  string      `json:"type"`
+}
+
+// TypedPoint A Point carrying the field type of every value, so consumers can tell
+// integers and floats apart
+type TypedPoint struct {
+	Name   string                `json:"name"`
+	Tags   map[string]string     `json:"tags"`
+	Values map[string]TypedValue `json:"values"`
+}
+
+// TypedValue A single value with its field type ("integer", "float" or "boolean")
+type TypedValue struct {
+	Value interface{}
+	Type  collector.ValueType
+}
+
+// MarshalJSON formats the value according to its type, floats always with a decimal
+// point, e.g. {"value":1.0,"type":"float"}. JSON has no NaN nor infinities, such
+// floats are formatted as null.
+func (v TypedValue) MarshalJSON() ([]byte, error) {
+	var value string
+	switch n := v.Value.(type) {
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			value = "null"
+			break
+		}
+		value = strconv.FormatFloat(n, 'f', -1, 64)
+		if !strings.Contains(value, ".") {
+			value += ".0"
+		}
+	case bool:
+		value = strconv.FormatBool(n)
+	case int64:
+		value = strconv.FormatInt(n, 10)
+	case uint64:
+		value = strconv.FormatUint(n, 10)
+	default:
+		b, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		value = string(b)
+	}
+	return []byte(`{"value":` + value + `,"type":"` + v.Type.String() + `"}`), nil
+}
+
 // Metrics returns a expvar.Func which implements Var by calling the function
 // and formatting the returned value using JSON. Use this function when you need
 // control of the measurement name for a data point.
@@ -31,12 +130,102 @@ type Point struct {
 //
 //
 func Metrics(measurement string) expvar.Func {
-	return func() interface{} {
-		v := collector.New(nil).CollectStats()
+	return MetricsWithTags(measurement, nil)
+}
+
+// MetricsWithTags works like Metrics and adds tags to the runtime tags of the point.
+// The runtime tags (go.os, go.arch, go.version) can't be overridden.
+func MetricsWithTags(measurement string, tags map[string]string) expvar.Func {
+	return safe(func() interface{} {
+		v := collectStats()
+		pointTags := v.Tags()
+		for k, t := range tags {
+			if _, ok := pointTags[k]; !ok {
+				pointTags[k] = t
+			}
+		}
 		return Point{
 			Name:   measurement,
-			Tags:   v.Tags(),
+			Tags:   pointTags,
 			Values: v,
 		}
+	})
+}
+
+// Var describes an expvar variable publishing runtime metrics under its own
+// measurement and tags, e.g. one per subsystem of a service.
+type Var struct {
+	Name        string
+	Measurement string
+	Tags        map[string]string
+}
+
+// Publish publishes every var with expvar.Publish. Like expvar.Publish, it panics
+// when a name is already registered.
+//
+//	influxdb.Publish(
+//	    influxdb.Var{Name: "runtime_api", Measurement: "api", Tags: map[string]string{"subsystem": "api"}},
+//	    influxdb.Var{Name: "runtime_worker", Measurement: "worker", Tags: map[string]string{"subsystem": "worker"}},
+//	)
+func Publish(vars ...Var) {
+	for _, v := range vars {
+		expvar.Publish(v.Name, MetricsWithTags(v.Measurement, v.Tags))
 	}
 }
+
+// MetricsVerbose works like Metrics but formats a VerbosePoint, including the unit
+// and type (gauge or counter) of every value from the collector metadata.
+func MetricsVerbose(measurement string) expvar.Func {
+	return safe(func() interface{} {
+		v := collectStats()
+		values := v.Values()
+		point := VerbosePoint{
+			Name:   measurement,
+			Tags:   v.Tags(),
+			Values: make(map[string]VerboseValue, len(values)),
+		}
+		for key, value := range values {
+			m, _ := collector.Lookup(key)
+			point.Values[key] = VerboseValue{Value: value, Unit: m.Unit, Type: m.Kind.String()}
+		}
+		return point
+	})
+}
+
+// FlatMetrics works like Metrics but formats a single flat map holding the tags, the
+// values and the measurement under the "measurement" key, for tooling which can't
+// handle the nested Point structure.
+func FlatMetrics(measurement string) expvar.Func {
+	return safe(func() interface{} {
+		v := collectStats()
+		values := v.Values()
+		tags := v.Tags()
+		flat := make(map[string]interface{}, len(values)+len(tags)+1)
+		for key, value := range values {
+			flat[key] = value
+		}
+		for key, tag := range tags {
+			flat[key] = tag
+		}
+		flat["measurement"] = measurement
+		return flat
+	})
+}
+
+// MetricsTyped works like Metrics but formats a TypedPoint, including the field type
+// of every value from the collector metadata.
+func MetricsTyped(measurement string) expvar.Func {
+	return safe(func() interface{} {
+		v := collectStats()
+		values := v.Values()
+		point := TypedPoint{
+			Name:   measurement,
+			Tags:   v.Tags(),
+			Values: make(map[string]TypedValue, len(values)),
+		}
+		for key, value := range values {
+			point.Values[key] = TypedValue{Value: collector.Typed(key, value), Type: collector.TypeOf(key, value)}
+		}
+		return point
+	})
+}
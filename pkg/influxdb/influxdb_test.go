@@ -3,8 +3,13 @@ package influxdb
 import (
 	"encoding/json"
 	"expvar"
+	"fmt"
+	"math"
 	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
 )
 
 func TestMetrics(t *testing.T) {
@@ -30,11 +35,96 @@ func TestMetrics(t *testing.T) {
 	}
 }
 
+func TestMetricsVerbose(t *testing.T) {
+	point := &VerbosePoint{}
+	if err := json.Unmarshal([]byte(MetricsVerbose("test").String()), point); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]string{
+		"mem.alloc":           {"bytes", "gauge"},
+		"mem.malloc":          {"count", "counter"},
+		"mem.gc.pause_total":  {"nanoseconds", "counter"},
+		"mem.gc.cpu_fraction": {"fraction", "gauge"},
+		"cpu.goroutines":      {"count", "gauge"},
+	}
+
+	for key, exp := range expected {
+		v, ok := point.Values[key]
+		if !ok {
+			t.Errorf("expected key (%s) not found", key)
+			continue
+		}
+		if v.Unit != exp[0] || v.Type != exp[1] {
+			t.Errorf("unexpected metadata for %s:\ngot: %s %s\nexp: %s %s", key, v.Unit, v.Type, exp[0], exp[1])
+		}
+		if v.Value == nil {
+			t.Errorf("missing value for %s", key)
+		}
+	}
+}
+
+func TestFlatMetrics(t *testing.T) {
+	flat := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(FlatMetrics("test").String()), &flat); err != nil {
+		t.Fatal(err)
+	}
+
+	if flat["measurement"] != "test" {
+		t.Errorf("unexpected measurement:\ngot: %v\nexp: %s", flat["measurement"], "test")
+	}
+	if flat["go.os"] != runtime.GOOS {
+		t.Errorf("unexpected go.os:\ngot: %v\nexp: %s", flat["go.os"], runtime.GOOS)
+	}
+	for _, key := range []string{"go.arch", "go.version", "mem.alloc", "cpu.goroutines"} {
+		if _, ok := flat[key]; !ok {
+			t.Errorf("expected key (%s) not found", key)
+		}
+	}
+	if _, ok := flat["values"]; ok {
+		t.Error("unexpected nested values")
+	}
+}
+
+// publishRuns makes the names published by TestPublish unique to each run, as expvar
+// panics when a name is published twice, e.g. with -count.
+var publishRuns int
+
+func TestPublish(t *testing.T) {
+	publishRuns++
+	api, worker := fmt.Sprintf("test_publish_api_%d", publishRuns), fmt.Sprintf("test_publish_worker_%d", publishRuns)
+	Publish(
+		Var{Name: api, Measurement: "api", Tags: map[string]string{"subsystem": "api", "go.os": "plan9"}},
+		Var{Name: worker, Measurement: "worker", Tags: map[string]string{"subsystem": "worker"}},
+	)
+
+	for name, exp := range map[string]string{api: "api", worker: "worker"} {
+		v := expvar.Get(name)
+		if v == nil {
+			t.Fatalf("expected var (%s) not published", name)
+		}
+
+		point := &Point{}
+		if err := json.Unmarshal([]byte(v.String()), point); err != nil {
+			t.Fatal(err)
+		}
+		if point.Name != exp {
+			t.Errorf("expected name (%s) got (%s)", exp, point.Name)
+		}
+		if point.Tags["subsystem"] != exp {
+			t.Errorf("expected tag subsystem (%s) got (%s)", exp, point.Tags["subsystem"])
+		}
+		if point.Tags["go.os"] != runtime.GOOS {
+			t.Errorf("runtime tag overridden: go.os=%s", point.Tags["go.os"])
+		}
+	}
+}
+
 func BenchmarkMetrics(b *testing.B) {
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			Metrics("some_metric").String()
+			_ = Metrics("some_metric").String()
 		}
 	})
 }
@@ -43,7 +133,7 @@ func BenchmarkMemStat(b *testing.B) {
 	b.ReportAllocs()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			expvar.Func(memStats).String()
+			_ = expvar.Func(memStats).String()
 		}
 	})
 }
@@ -53,3 +143,88 @@ func memStats() interface{} {
 	runtime.ReadMemStats(stats)
 	return *stats
 }
+
+func TestMetricsRecoversPanic(t *testing.T) {
+	defer func(orig func() collector.Fields) { collectStats = orig }(collectStats)
+
+	panicking := true
+	collectStats = func() collector.Fields {
+		if panicking {
+			panic("process metrics unavailable")
+		}
+		return collector.Fields{NumGoroutine: 42}
+	}
+
+	f := Metrics("test")
+	failed := map[string]string{}
+	if err := json.Unmarshal([]byte(f.String()), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(failed["error"], "process metrics unavailable") {
+		t.Errorf("expected an error object, got %v", failed)
+	}
+
+	panicking = false
+	f.Value()
+	panicking = true
+	point := &Point{}
+	if err := json.Unmarshal([]byte(f.String()), point); err != nil {
+		t.Fatal(err)
+	}
+	if point.Values.NumGoroutine != 42 {
+		t.Errorf("expected the last known value:\ngot: %d\nexp: %d", point.Values.NumGoroutine, 42)
+	}
+}
+
+func TestMetricsTyped(t *testing.T) {
+	point := struct {
+		Values map[string]struct {
+			Value json.Number `json:"value"`
+			Type  string      `json:"type"`
+		} `json:"values"`
+	}{}
+	decoder := json.NewDecoder(strings.NewReader(MetricsTyped("test").String()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&point); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(point.Values) != len(collector.Keys()) {
+		t.Errorf("unexpected number of values:\ngot: %d\nexp: %d", len(point.Values), len(collector.Keys()))
+	}
+	for key, v := range point.Values {
+		m, _ := collector.Lookup(key)
+		if v.Type != m.Type().String() {
+			t.Errorf("unexpected type for %s:\ngot: %s\nexp: %s", key, v.Type, m.Type())
+		}
+		isFloat := strings.Contains(v.Value.String(), ".")
+		if isFloat != (m.Type() == collector.Float) {
+			t.Errorf("unexpected formatting of %s (%s): %s", key, v.Type, v.Value)
+		}
+	}
+}
+
+func TestTypedValueJSON(t *testing.T) {
+	for _, test := range []struct {
+		value interface{}
+		exp   string
+	}{
+		{1.5, `{"value":1.5,"type":"float"}`},
+		{2.0, `{"value":2.0,"type":"float"}`},
+		{math.NaN(), `{"value":null,"type":"float"}`},
+		{math.Inf(1), `{"value":null,"type":"float"}`},
+		{math.Inf(-1), `{"value":null,"type":"float"}`},
+		{true, `{"value":true,"type":"boolean"}`},
+		{false, `{"value":false,"type":"boolean"}`},
+		{int64(3), `{"value":3,"type":"integer"}`},
+	} {
+		b, err := json.Marshal(TypedValue{Value: test.value, Type: collector.TypeOf("test.value", test.value)})
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", test.value, err)
+			continue
+		}
+		if got := string(b); got != test.exp {
+			t.Errorf("unexpected JSON of %v:\ngot: %s\nexp: %s", test.value, got, test.exp)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package lineprotocol
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+// Encoder formats collected statistics as InfluxDB line protocol, with the runtime
+// tags, the values typed according to the collector metadata and a nanosecond
+// timestamp. It is shared by the exporters which only differ by their transport, such
+// as Writer and the questdb and unixgram packages.
+type Encoder struct {
+	// Measurement of the points.
+	Measurement string
+
+	// Name returns the name of a tag or field key in the points, e.g. to replace the
+	// dots rejected by the server. Defaults to the key itself.
+	Name func(key string) string
+}
+
+// Point returns fields collected at t as a point with sorted tags and fields. A zero t
+// leaves the timestamp out, for the server to set it at ingestion.
+func (e Encoder) Point(fields collector.Fields, t time.Time) *write.Point {
+	name := e.Name
+	if name == nil {
+		name = func(key string) string { return key }
+	}
+
+	p := influxdb2.NewPointWithMeasurement(e.Measurement)
+	for k, v := range fields.Tags() {
+		p.AddTag(name(k), v)
+	}
+	for k, v := range fields.Values() {
+		p.AddField(name(k), collector.Typed(k, v))
+	}
+	p.SortTags().SortFields()
+	if !t.IsZero() {
+		p.SetTime(t)
+	}
+	return p
+}
+
+// Encode returns fields collected at t as one line, see Point.
+func (e Encoder) Encode(fields collector.Fields, t time.Time) string {
+	return write.PointToLineProtocol(e.Point(fields, t), time.Nanosecond)
+}
@@ -0,0 +1,133 @@
+// Package lineprotocol writes runtime metrics as InfluxDB line protocol to an
+// io.Writer, e.g. a file tailed by Telegraf, without the InfluxDB HTTP client.
+//
+//	f, err := filesink.Open("/var/log/app/runtime.lp", false)
+//	if err != nil {
+//		// handle error
+//	}
+//	w, err := lineprotocol.RunCollector(&lineprotocol.Config{}, f)
+//	if err != nil {
+//		// handle error
+//	}
+//	defer w.Stop()
+package lineprotocol
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+const (
+	defaultMeasurement        = "go.runtime"
+	defaultCollectionInterval = 10 * time.Second
+)
+
+// Config configures RunCollector.
+type Config struct {
+	// Measurement of the points.
+	// Default is "go.runtime".
+	Measurement string
+
+	// CollectionInterval is the interval between collections.
+	// Default is 10s.
+	CollectionInterval time.Duration
+
+	// Logger receives the write errors.
+	// Default is the standard logger of package log.
+	Logger Logger
+}
+
+// Writer writes collected statistics as one line of InfluxDB line protocol each, see
+// Encoder. Writers with a Flush() error method, such as a filesink.Sink or a
+// bufio.Writer, are flushed after every line. It is safe for concurrent use.
+type Writer struct {
+	// Measurement of the points.
+	Measurement string
+
+	// Logger receives the write errors of Callback. Defaults to the standard logger.
+	Logger Logger
+
+	mu sync.Mutex
+	w  io.Writer
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New returns a Writer writing points of measurement to w.
+func New(w io.Writer, measurement string) *Writer {
+	if measurement == "" {
+		measurement = defaultMeasurement
+	}
+	return &Writer{Measurement: measurement, w: w, done: make(chan struct{})}
+}
+
+// RunCollector runs a collector every CollectionInterval writing to w until the
+// returned Writer is stopped.
+func RunCollector(config *Config, w io.Writer) (*Writer, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if w == nil {
+		return nil, fmt.Errorf("lineprotocol: nil writer")
+	}
+	if config.CollectionInterval < 0 {
+		return nil, fmt.Errorf("lineprotocol: negative CollectionInterval %s", config.CollectionInterval)
+	}
+
+	lw := New(w, config.Measurement)
+	lw.Logger = config.Logger
+	c := collector.New(lw.Callback())
+	if config.CollectionInterval > 0 {
+		c.PauseDur = config.CollectionInterval
+	} else {
+		c.PauseDur = defaultCollectionInterval
+	}
+	c.Done = lw.done
+	go c.Run()
+
+	return lw, nil
+}
+
+// Write writes fields collected at t as one line.
+func (lw *Writer) Write(fields collector.Fields, t time.Time) error {
+	line := Encoder{Measurement: lw.Measurement}.Encode(fields, t)
+
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if _, err := io.WriteString(lw.w, line); err != nil {
+		return err
+	}
+	if f, ok := lw.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Callback returns a collector.CollectStatsCallback writing every collection, logging
+// write errors.
+func (lw *Writer) Callback() collector.CollectStatsCallback {
+	return func(fields collector.Fields) {
+		if err := lw.Write(fields, time.Now()); err != nil {
+			lw.logger().Printf("lineprotocol: writing point: %v", err)
+		}
+	}
+}
+
+// Stop stops the collector started by RunCollector. The io.Writer is left open. It may
+// be called more than once.
+func (lw *Writer) Stop() {
+	lw.stopOnce.Do(func() { close(lw.done) })
+}
+
+func (lw *Writer) logger() Logger {
+	if lw.Logger == nil {
+		return stdLogger{}
+	}
+	return lw.Logger
+}
@@ -0,0 +1,111 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := New(bw, "app runtime,blue")
+
+	fields := collector.Fields{NumGoroutine: 3, GCCPUFraction: 0.5, Goos: "linux", Goarch: "amd64", Version: "go 1.x,beta=2"}
+	if err := w.Write(fields, time.Unix(0, 42)); err != nil {
+		t.Fatal(err)
+	}
+
+	line := buf.String()
+	if !strings.HasPrefix(line, `app\ runtime\,blue,go.arch=amd64,go.os=linux,go.version=go\ 1.x\,beta\=2 `) {
+		t.Errorf("unexpected measurement and tags:\n%s", line)
+	}
+	for _, exp := range []string{"cpu.goroutines=3i", "mem.gc.count=0i", "mem.gc.cpu_fraction=0.5"} {
+		if !strings.Contains(line, exp) {
+			t.Errorf("expected %q in:\n%s", exp, line)
+		}
+	}
+	if !strings.HasSuffix(line, " 42\n") {
+		t.Errorf("expected the nanosecond timestamp:\n%s", line)
+	}
+}
+
+func TestRunCollector(t *testing.T) {
+	if _, err := RunCollector(nil, nil); err == nil {
+		t.Error("expected error for nil writer")
+	}
+
+	lines := make(chan string, 1)
+	w, err := RunCollector(&Config{CollectionInterval: time.Hour}, writerFunc(func(p []byte) (int, error) {
+		select {
+		case lines <- string(p):
+		default:
+		}
+		return len(p), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, defaultMeasurement+",") {
+			t.Errorf("unexpected line:\n%s", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line written")
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestEncoder(t *testing.T) {
+	e := Encoder{Measurement: "go_runtime", Name: func(key string) string { return strings.Replace(key, ".", "_", -1) }}
+	line := e.Encode(collector.Fields{NumGoroutine: 3, Goos: "linux", Goarch: "amd64", Version: "go1.16"}, time.Time{})
+
+	if !strings.HasPrefix(line, "go_runtime,go_arch=amd64,go_os=linux,go_version=go1.16 ") {
+		t.Errorf("unexpected measurement and tags:\n%s", line)
+	}
+	if !strings.Contains(line, "cpu_goroutines=3i") {
+		t.Errorf("expected renamed field in:\n%s", line)
+	}
+	if parts := strings.Fields(line); len(parts) != 2 {
+		t.Errorf("expected no timestamp for a zero time:\n%s", line)
+	}
+}
+
+func TestCallbackLogger(t *testing.T) {
+	logs := make(chan string, 1)
+	w := New(writerFunc(func([]byte) (int, error) { return 0, errors.New("disk full") }), "")
+	w.Logger = chanLogger(logs)
+	w.Callback()(collector.Fields{})
+
+	select {
+	case msg := <-logs:
+		if !strings.Contains(msg, "disk full") {
+			t.Errorf("unexpected log message: %s", msg)
+		}
+	default:
+		t.Error("expected write error to be logged")
+	}
+}
+
+type chanLogger chan string
+
+func (l chanLogger) Printf(format string, v ...interface{}) {
+	select {
+	case l <- fmt.Sprintf(format, v...):
+	default:
+	}
+}
@@ -0,0 +1,17 @@
+package lineprotocol
+
+import "log"
+
+type (
+	// Logger receives the write errors of a Writer, *log.Logger implements it.
+	Logger interface {
+		Printf(format string, v ...interface{})
+	}
+
+	stdLogger struct{}
+)
+
+// Printf logs with the standard logger.
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Aggregation functions available in Config.AggregationFuncs.
+const (
+	AggregateMin = "min"
+	AggregateMax = "max"
+	AggregateAvg = "avg"
+)
+
+var defaultAggregationFuncs = []string{AggregateMin, AggregateMax, AggregateAvg}
+
+type (
+	// aggregator folds the samples collected during a window into one set of values,
+	// reporting each numeric sample as "<key>_<func>".
+	aggregator struct {
+		window time.Duration
+		funcs  []string
+
+		start   time.Time
+		samples map[string]*series
+		latest  map[string]interface{}
+	}
+
+	series struct {
+		min, max, sum float64
+		n             int
+		isFloat       bool
+	}
+)
+
+func checkAggregationFuncs(funcs []string) error {
+	for _, name := range funcs {
+		switch name {
+		case AggregateMin, AggregateMax, AggregateAvg:
+		default:
+			return fmt.Errorf("metrics: unknown aggregation function %q", name)
+		}
+	}
+	return nil
+}
+
+func newAggregator(window time.Duration, funcs []string) *aggregator {
+	return &aggregator{window: window, funcs: funcs}
+}
+
+// add records the values sampled at now. The windows follow each other from the first
+// sample: a sample at or after the end of the current window closes it, the aggregated
+// values of its samples are returned with ok set and the sample starts the next window.
+// Values which are not numbers are kept from the latest sample of the window.
+func (a *aggregator) add(values map[string]interface{}, now time.Time) (aggregated map[string]interface{}, ok bool) {
+	if a.samples != nil && now.Sub(a.start) >= a.window {
+		aggregated, ok = a.aggregate(), true
+		// windows without samples are skipped, the next window keeps the alignment
+		a.start = a.start.Add(now.Sub(a.start).Truncate(a.window))
+		a.samples = nil
+	} else if a.samples == nil {
+		a.start = now
+	}
+	if a.samples == nil {
+		a.samples = make(map[string]*series, len(values))
+	}
+
+	for k, v := range values {
+		f, isFloat, numeric := number(v)
+		if !numeric {
+			continue
+		}
+		s, found := a.samples[k]
+		if !found {
+			s = &series{min: f, max: f, isFloat: isFloat}
+			a.samples[k] = s
+		}
+		if f < s.min {
+			s.min = f
+		}
+		if f > s.max {
+			s.max = f
+		}
+		s.sum += f
+		s.n++
+	}
+	a.latest = values
+	return aggregated, ok
+}
+
+// aggregate returns the aggregated values of the samples of the current window.
+func (a *aggregator) aggregate() map[string]interface{} {
+	aggregated := make(map[string]interface{}, len(a.samples)*len(a.funcs))
+	for k, v := range a.latest {
+		if _, _, numeric := number(v); !numeric {
+			aggregated[k] = v
+		}
+	}
+	for k, s := range a.samples {
+		for _, name := range a.funcs {
+			switch name {
+			case AggregateMin:
+				aggregated[k+"_"+name] = s.value(s.min)
+			case AggregateMax:
+				aggregated[k+"_"+name] = s.value(s.max)
+			case AggregateAvg:
+				aggregated[k+"_"+name] = s.sum / float64(s.n)
+			}
+		}
+	}
+	return aggregated
+}
+
+// value returns f with the type of the aggregated samples.
+func (s *series) value(f float64) interface{} {
+	if s.isFloat {
+		return f
+	}
+	return int64(f)
+}
+
+// number converts the numeric Go types found in collector.Fields values to float64.
+func number(v interface{}) (f float64, isFloat bool, ok bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), false, true
+	case int32:
+		return float64(n), false, true
+	case int64:
+		return float64(n), false, true
+	case uint64:
+		return float64(n), false, true
+	case float64:
+		return n, true, true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// bucketPoint is a point waiting in the point buffer for the write API of its bucket.
+type bucketPoint struct {
+	bucket string
+	point  *write.Point
+}
+
+// bufferPoint queues p for the write API of bucket without blocking. When the buffer
+// is full, e.g. because InfluxDB is slow to accept writes, p is dropped and a warning
+// is logged once until the buffer accepts points again.
+func (r *statsSender) bufferPoint(bucket string, p *write.Point) {
+	select {
+	case r.pc <- bucketPoint{bucket: bucket, point: p}:
+		atomic.StoreInt32(&r.bufferFull, 0)
+	default:
+		atomic.AddInt64(&r.stats.dropped, 1)
+		if atomic.CompareAndSwapInt32(&r.bufferFull, 0, 1) {
+			r.config.logger().Printf("metrics: point buffer full (%d points), dropping points", cap(r.pc))
+		}
+	}
+}
+
+// runPointBuffer hands the buffered points to the write APIs until the sender is
+// stopped. The points left in the buffer are written by drainPoints.
+func (r *statsSender) runPointBuffer() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case bp := <-r.pc:
+			r.writeAPIFor(bp.bucket).WritePoint(bp.point)
+		}
+	}
+}
+
+// drainPoints hands the points left in the buffer to the write APIs.
+func (r *statsSender) drainPoints() {
+	for {
+		select {
+		case bp := <-r.pc:
+			r.writeAPIFor(bp.bucket).WritePoint(bp.point)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// write sends p to the write API of bucket. With DeduplicatePoints, the point is held
+// back until a different point arrives or the flush window ends, and replaced by
+// identical successors so only the latest one gets written. With DownsampleBucket, the
+// time of the point is floored to the bucket and it is held back until a point of a
+// later bucket arrives, so only the latest one per bucket gets written.
+func (r *statsSender) write(bucket string, p *write.Point) {
+	if r.config.DownsampleBucket > 0 {
+		p.SetTime(p.Time().Truncate(r.config.DownsampleBucket))
+	}
+	if !r.config.DeduplicatePoints && r.config.DownsampleBucket <= 0 {
+		r.writePoint(bucket, p)
+		return
+	}
+
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(map[string]*write.Point)
+	}
+	key := bucket + "\x00" + seriesKey(p)
+	if prev, ok := r.pending[key]; ok {
+		if r.replaces(prev, p) {
+			atomic.AddInt64(&r.stats.deduplicated, 1)
+		} else {
+			r.writePoint(bucket, prev)
+		}
+	}
+	r.pending[key] = p
+}
+
+// replaces reports whether p supersedes the held back point prev of the same series.
+func (r *statsSender) replaces(prev, p *write.Point) bool {
+	if r.config.DownsampleBucket > 0 && prev.Time().Equal(p.Time()) {
+		return true
+	}
+	return r.config.DeduplicatePoints && pointKey(prev) == pointKey(p)
+}
+
+func (r *statsSender) runDeduplication() {
+	r.every(time.Duration(r.config.FlushInterval)*time.Millisecond, r.flushPending)
+}
+
+// flushPending writes the held back points, ending the flush window.
+func (r *statsSender) flushPending() {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+
+	for key, p := range r.pending {
+		r.writePoint(strings.SplitN(key, "\x00", 2)[0], p)
+		delete(r.pending, key)
+	}
+}
+
+// seriesKey identifies the series of a point by its measurement and tags.
+func seriesKey(p *write.Point) string {
+	parts := make([]string, 0, len(p.TagList()))
+	for _, t := range p.TagList() {
+		parts = append(parts, t.Key+"="+t.Value)
+	}
+	sort.Strings(parts)
+	return p.Name() + "\x00" + strings.Join(parts, "\x00")
+}
+
+// pointKey identifies a point by its measurement, tags and field values, ignoring its time.
+func pointKey(p *write.Point) string {
+	parts := make([]string, 0, len(p.TagList())+len(p.FieldList()))
+	for _, t := range p.TagList() {
+		parts = append(parts, "t:"+t.Key+"="+t.Value)
+	}
+	for _, f := range p.FieldList() {
+		parts = append(parts, fmt.Sprintf("f:%s=%T:%v", f.Key, f.Value, f.Value))
+	}
+	sort.Strings(parts)
+	return p.Name() + "\x00" + strings.Join(parts, "\x00")
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+type (
+	// dryRunClient replaces the InfluxDB client with DryRun, logging the points
+	// instead of writing them.
+	dryRunClient struct {
+		logger Logger
+	}
+
+	dryRunWriteAPI struct {
+		logger Logger
+	}
+)
+
+func (c dryRunClient) WriteAPI(string, string) api.WriteAPI { return dryRunWriteAPI{logger: c.logger} }
+
+func (dryRunClient) Health(context.Context) (*domain.HealthCheck, error) {
+	return &domain.HealthCheck{Status: domain.HealthCheckStatusPass}, nil
+}
+
+func (dryRunClient) Close() {}
+
+func (w dryRunWriteAPI) WriteRecord(line string) {
+	w.logger.Printf("metrics: dry run: %s", strings.TrimSuffix(line, "\n"))
+}
+
+func (w dryRunWriteAPI) WritePoint(point *write.Point) {
+	w.WriteRecord(write.PointToLineProtocol(point, time.Nanosecond))
+}
+
+func (dryRunWriteAPI) Flush() {}
+
+func (dryRunWriteAPI) Errors() <-chan error { return nil }
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxFailedBatches bounds the number of failed batches kept for dumping, the oldest
+// ones are dropped first.
+const maxFailedBatches = 1000
+
+type (
+	// failedWrites keeps the line protocol of the batches the InfluxDB client failed to
+	// write and did not successfully retry since, so they can be dumped on shutdown.
+	failedWrites struct {
+		logger Logger
+
+		mu      sync.Mutex
+		batches []string
+	}
+
+	failedWritesTransport struct {
+		next   http.RoundTripper
+		failed *failedWrites
+	}
+)
+
+// instrument wraps the transport of client so failed writes are recorded in f.
+func (f *failedWrites) instrument(client *http.Client) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = &failedWritesTransport{next: next, failed: f}
+}
+
+func (t *failedWritesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/write") || req.Body == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.next.RoundTrip(req)
+	lines, decodeErr := decodeBody(body, req.Header.Get("Content-Encoding"))
+	if decodeErr != nil {
+		t.failed.logger.Printf("metrics: decoding write request: %v", decodeErr)
+		return resp, err
+	}
+	t.failed.record(lines, err == nil && resp.StatusCode < 300)
+	return resp, err
+}
+
+func decodeBody(body []byte, encoding string) (string, error) {
+	if encoding != "gzip" {
+		return string(body), nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	lines, err := ioutil.ReadAll(r)
+	return string(lines), err
+}
+
+// record adds a failed batch, or removes it once a retry succeeded.
+func (f *failedWrites) record(lines string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, b := range f.batches {
+		if b == lines {
+			f.batches = append(f.batches[:i], f.batches[i+1:]...)
+			break
+		}
+	}
+	if ok {
+		return
+	}
+	if len(f.batches) == maxFailedBatches {
+		f.batches = f.batches[1:]
+	}
+	f.batches = append(f.batches, lines)
+}
+
+// dump writes the failed batches as line protocol to w.
+func (f *failedWrites) dump(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, lines := range f.batches {
+		if !strings.HasSuffix(lines, "\n") {
+			lines += "\n"
+		}
+		if _, err := io.WriteString(w, lines); err != nil {
+			return err
+		}
+	}
+	f.batches = nil
+	return nil
+}
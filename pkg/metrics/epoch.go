@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const restartEpochFile = "restart_epoch"
+
+// nextRestartEpoch increments the restart epoch persisted in dir and returns it. A
+// missing or corrupt state file starts over at 1; failing to persist the new value
+// is logged and the value is still used.
+func nextRestartEpoch(dir string, logger Logger) int64 {
+	path := filepath.Join(dir, restartEpochFile)
+
+	var epoch int64
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if epoch, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err != nil || epoch < 0 {
+			logger.Printf("metrics: corrupt restart epoch in %s, starting over", path)
+			epoch = 0
+		}
+	} else if !os.IsNotExist(err) {
+		logger.Printf("metrics: reading restart epoch: %v", err)
+	}
+	epoch++
+
+	if err := writeFileAtomic(path, []byte(strconv.FormatInt(epoch, 10)+"\n")); err != nil {
+		logger.Printf("metrics: persisting restart epoch: %v", err)
+	}
+	return epoch
+}
+
+// writeFileAtomic replaces path with data, so a crash never leaves a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
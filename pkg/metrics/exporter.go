@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type (
+	// exporterStats instruments the HTTP requests of the InfluxDB client writing points.
+	exporterStats struct {
+		mu           sync.Mutex
+		writes       int64
+		failures     int64
+		bytesSent    int64
+		points       int64
+		lastLatency  time.Duration
+		totalLatency time.Duration
+		lastErr      error
+	}
+
+	exporterTransport struct {
+		next  http.RoundTripper
+		stats *exporterStats
+	}
+)
+
+// instrument wraps the transport of client so write requests are recorded in s.
+func (s *exporterStats) instrument(client *http.Client) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = &exporterTransport{next: next, stats: s}
+}
+
+func (t *exporterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/write") {
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	// the client retries failed writes, every failure but a rejected point is retried
+	failed := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	var points int64
+	if err == nil && resp.StatusCode < 300 {
+		points = countPoints(body, req.Header.Get("Content-Encoding"))
+	}
+	// the gzipped bodies of the client are streamed, without a ContentLength
+	t.stats.record(time.Since(start), int64(len(body)), points, failed)
+
+	writeErr := err
+	if err == nil && resp.StatusCode >= 300 {
+		writeErr = fmt.Errorf("metrics: write failed with status %d", resp.StatusCode)
+	}
+	t.stats.mu.Lock()
+	t.stats.lastErr = writeErr
+	t.stats.mu.Unlock()
+
+	return resp, err
+}
+
+// countPoints returns the number of lines of the line protocol body of a write request.
+func countPoints(body []byte, encoding string) int64 {
+	lines, err := decodeBody(body, encoding)
+	if err != nil {
+		return 0
+	}
+	var n int64
+	for _, line := range strings.Split(lines, "\n") {
+		if line != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// record records a write request of latency, sending bytes, and the number of points
+// accepted by InfluxDB.
+func (s *exporterStats) record(latency time.Duration, bytes, points int64, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+	s.points += points
+	s.lastLatency = latency
+	s.totalLatency += latency
+	if bytes > 0 {
+		s.bytesSent += bytes
+	}
+	if failed {
+		s.failures++
+	}
+}
+
+// lastError returns the error of the last write request, nil if it succeeded.
+func (s *exporterStats) lastError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// point returns the recorded statistics as a point of measurement, or nil before the
+// first write.
+func (s *exporterStats) point(measurement string, now time.Time) *write.Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writes == 0 {
+		return nil
+	}
+	return influxdb2.NewPointWithMeasurement(measurement).
+		AddField("write.count", s.writes).
+		AddField("write.failures", s.failures).
+		AddField("write.bytes_sent", s.bytesSent).
+		AddField("write.latency_last", int64(s.lastLatency)).
+		AddField("write.latency_avg", int64(s.totalLatency)/s.writes).
+		SetTime(now)
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestExporterStats(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusNoContent}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(time.Millisecond)
+		status := statuses[0]
+		statuses = statuses[1:]
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})}
+	stats := &exporterStats{}
+	stats.instrument(client)
+
+	if p := stats.point("test.exporter", time.Now()); p != nil {
+		t.Error("unexpected point before the first write")
+	}
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, _ = gw.Write([]byte("m v=1i\nm v=2i\n"))
+	gw.Close()
+
+	for i := 0; i < 2; i++ {
+		// like the client, stream the gzipped body, without a known length
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := pw.Write(compressed.Bytes())
+			pw.CloseWithError(err)
+		}()
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8086/api/v2/write?bucket=b", pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if err := stats.lastError(); (err != nil) != (i == 0) {
+			t.Errorf("unexpected last write error after write %d: %v", i+1, err)
+		}
+	}
+
+	p := stats.point("test.exporter", time.Now())
+	if p == nil {
+		t.Fatal("expected a point after writes")
+	}
+	fields := map[string]interface{}{}
+	for _, f := range p.FieldList() {
+		fields[f.Key] = f.Value
+	}
+	if fields["write.count"] != int64(2) || fields["write.failures"] != int64(1) || fields["write.bytes_sent"] != int64(2*compressed.Len()) {
+		t.Errorf("unexpected write statistics: %v", fields)
+	}
+	// only the points of the successful write are written
+	if stats.points != 2 {
+		t.Errorf("unexpected number of written points:\ngot: %d\nexp: %d", stats.points, 2)
+	}
+	if latency, _ := fields["write.latency_last"].(int64); latency < int64(time.Millisecond) {
+		t.Errorf("write latency not recorded:\ngot: %d\nexp: >= %d", latency, int64(time.Millisecond))
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+type (
+	// fanoutClient writes to several InfluxDB servers with Config.Addrs. Every server
+	// has its own client, so a failing one keeps its batches in its own retry queue
+	// while the others are written to. It only implements the influxClient used by the
+	// sender.
+	fanoutClient struct {
+		addrs   []string
+		clients []influxdb2.Client
+	}
+
+	fanoutWriteAPI struct {
+		addrs []string
+		apis  []api.WriteAPI
+	}
+)
+
+func newFanoutClient(addrs []string, authToken string, options *influxdb2.Options) *fanoutClient {
+	c := &fanoutClient{addrs: addrs}
+	for _, addr := range addrs {
+		c.clients = append(c.clients, influxdb2.NewClientWithOptions(addr, authToken, options))
+	}
+	return c
+}
+
+func (c *fanoutClient) WriteAPI(org, bucket string) api.WriteAPI {
+	w := &fanoutWriteAPI{addrs: c.addrs}
+	for _, client := range c.clients {
+		w.apis = append(w.apis, client.WriteAPI(org, bucket))
+	}
+	return w
+}
+
+// Health reports the first server which is not healthy, as an error naming it.
+func (c *fanoutClient) Health(ctx context.Context) (*domain.HealthCheck, error) {
+	for i, client := range c.clients {
+		health, err := client.Health(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.addrs[i], err)
+		}
+		if health.Status != domain.HealthCheckStatusPass {
+			return nil, fmt.Errorf("%s: %s", c.addrs[i], health.Status)
+		}
+	}
+	return &domain.HealthCheck{Status: domain.HealthCheckStatusPass}, nil
+}
+
+func (c *fanoutClient) Close() {
+	for _, client := range c.clients {
+		client.Close()
+	}
+}
+
+func (w *fanoutWriteAPI) WriteRecord(line string) {
+	for _, member := range w.apis {
+		member.WriteRecord(line)
+	}
+}
+
+func (w *fanoutWriteAPI) WritePoint(point *write.Point) {
+	for _, member := range w.apis {
+		member.WritePoint(point)
+	}
+}
+
+func (w *fanoutWriteAPI) Flush() {
+	for _, member := range w.apis {
+		member.Flush()
+	}
+}
+
+// Errors merges the errors of the servers, prefixed with their address. The channel
+// is closed once the client is closed.
+func (w *fanoutWriteAPI) Errors() <-chan error {
+	errs := make(chan error)
+	var wg sync.WaitGroup
+	for i, member := range w.apis {
+		ch := member.Errors()
+		if ch == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(addr string, ch <-chan error) {
+			defer wg.Done()
+			for err := range ch {
+				errs <- fmt.Errorf("%s: %v", addr, err)
+			}
+		}(w.addrs[i], ch)
+	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+	return errs
+}
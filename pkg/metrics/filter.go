@@ -0,0 +1,35 @@
+package metrics
+
+// filterFields removes from values the fields not listed in IncludeFields, when set,
+// and those listed in ExcludeFields. The listed fields missing from the values of the
+// first collection are logged once, as they are likely misspelled.
+func (r *statsSender) filterFields(values map[string]interface{}) {
+	if len(r.config.IncludeFields) == 0 && len(r.config.ExcludeFields) == 0 {
+		return
+	}
+
+	r.unknownFieldsOnce.Do(func() {
+		for _, names := range [][]string{r.config.IncludeFields, r.config.ExcludeFields} {
+			for _, name := range names {
+				if _, ok := values[name]; !ok {
+					r.config.logger().Printf("metrics: unknown field %q in IncludeFields or ExcludeFields", name)
+				}
+			}
+		}
+	})
+
+	if len(r.config.IncludeFields) > 0 {
+		include := make(map[string]bool, len(r.config.IncludeFields))
+		for _, name := range r.config.IncludeFields {
+			include[name] = true
+		}
+		for k := range values {
+			if !include[k] {
+				delete(values, k)
+			}
+		}
+	}
+	for _, name := range r.config.ExcludeFields {
+		delete(values, name)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+)
+
+// JSONHandler returns an http.Handler which responds to GET requests with the current
+// statistics formatted as an influxdb.Point, without publishing a global expvar.
+// The measurement name defaults to "go.runtime" and can be overridden per request
+// with the measurement query parameter.
+//
+//	http.Handle("/debug/runtime", metrics.JSONHandler())
+func JSONHandler() http.Handler {
+	return jsonHandler(func(r *http.Request) string {
+		if measurement := r.URL.Query().Get("measurement"); measurement != "" {
+			return measurement
+		}
+		return defaultMeasurement
+	})
+}
+
+// Handler works like JSONHandler with a fixed measurement name, "go.runtime" if empty,
+// ignoring the measurement query parameter.
+//
+//	http.Handle("/debug/runtime-metrics", metrics.Handler("api.runtime"))
+func Handler(measurement string) http.Handler {
+	if measurement == "" {
+		measurement = defaultMeasurement
+	}
+	return jsonHandler(func(*http.Request) string { return measurement })
+}
+
+func jsonHandler(measurement func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(influxdb.Metrics(measurement(r))())
+	})
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+)
+
+func TestJSONHandler(t *testing.T) {
+	for query, exp := range map[string]string{"": defaultMeasurement, "?measurement=custom": "custom"} {
+		rec := httptest.NewRecorder()
+		JSONHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status:\ngot: %d\nexp: %d", rec.Code, http.StatusOK)
+		}
+
+		point := &influxdb.Point{}
+		if err := json.Unmarshal(rec.Body.Bytes(), point); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if point.Name != exp {
+			t.Errorf("expected name (%s) got (%s)", exp, point.Name)
+		}
+		if point.Tags["go.os"] == "" {
+			t.Error("expected tag (go.os) not found")
+		}
+
+		raw := struct {
+			Values map[string]interface{} `json:"values"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"cpu.goroutines", "mem.lookups", "mem.gc.count"} {
+			if _, ok := raw.Values[key]; !ok {
+				t.Errorf("expected key (%s) not found", key)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	JSONHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status:\ngot: %d\nexp: %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	for measurement, exp := range map[string]string{"": defaultMeasurement, "api.runtime": "api.runtime"} {
+		rec := httptest.NewRecorder()
+		Handler(measurement).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?measurement=ignored", nil))
+
+		point := &influxdb.Point{}
+		if err := json.Unmarshal(rec.Body.Bytes(), point); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if point.Name != exp {
+			t.Errorf("expected name (%s) got (%s)", exp, point.Name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+func (r *statsSender) runHealthCheck() {
+	unhealthy := 0
+	r.every(r.config.HealthCheckInterval, func() {
+		unhealthy = r.checkHealth(unhealthy)
+	})
+}
+
+// checkHealth polls the server once given the number of consecutive failed checks so
+// far and returns the updated number. The client is recreated once it reaches
+// UnhealthyThreshold, so a single failed check never causes a reconnect.
+func (r *statsSender) checkHealth(unhealthy int) int {
+	r.mu.RLock()
+	client := r.client
+	r.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.HealthCheckTimeout)
+	defer cancel()
+
+	health, err := client.Health(ctx)
+	if err == nil && health.Status == domain.HealthCheckStatusPass {
+		return 0
+	}
+
+	unhealthy++
+	if unhealthy < r.config.UnhealthyThreshold {
+		return unhealthy
+	}
+
+	if err != nil {
+		r.config.logger().Printf("metrics: InfluxDB at %s unhealthy (%v), reconnecting", strings.Join(r.config.addrs(), ", "), err)
+	} else {
+		r.config.logger().Printf("metrics: InfluxDB at %s unhealthy (%s), reconnecting", strings.Join(r.config.addrs(), ", "), health.Status)
+	}
+	r.connect()
+	atomic.AddInt64(&r.stats.reconnects, 1)
+	// the async write API of the previous client flushes and stops on Close
+	go client.Close()
+
+	return 0
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import "log"
+
+type (
+	// Logger receives the warnings and errors of the collector, such as failed writes.
+	Logger interface {
+		Printf(format string, v ...interface{})
+	}
+
+	stdLogger struct{}
+)
+
+// DefaultLogger is the Logger used when Config.Logger is nil, it logs with the standard
+// logger of package log.
+var DefaultLogger Logger = stdLogger{}
+
+// Printf logs with the standard logger.
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// logger returns Logger, or DefaultLogger when it is nil.
+func (config *Config) logger() Logger {
+	if config.Logger == nil {
+		return DefaultLogger
+	}
+	return config.Logger
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import "time"
+
+// Option sets a field of the Config of RunCollectorWithOptions.
+type Option func(*Config)
+
+// RunCollectorWithOptions works like RunCollector with the Config built from the
+// defaults and opts, applied in order:
+//
+//	c, err := metrics.RunCollectorWithOptions(
+//		metrics.WithAddr("https://influxdb.example.com:8086"),
+//		metrics.WithBucket("runtime"),
+//		metrics.WithCollectionInterval(time.Minute),
+//	)
+func RunCollectorWithOptions(opts ...Option) (*Collector, error) {
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return RunCollector(config)
+}
+
+// WithConfig starts from a copy of config, for the settings without an Option. It
+// replaces the options applied before it.
+func WithConfig(config Config) Option {
+	return func(c *Config) { *c = config }
+}
+
+// WithAddr sets Config.Addr.
+func WithAddr(addr string) Option {
+	return func(c *Config) { c.Addr = addr }
+}
+
+// WithAuthToken sets Config.AuthToken.
+func WithAuthToken(token string) Option {
+	return func(c *Config) { c.AuthToken = token }
+}
+
+// WithOrg sets Config.Org.
+func WithOrg(org string) Option {
+	return func(c *Config) { c.Org = org }
+}
+
+// WithBucket sets Config.Bucket.
+func WithBucket(bucket string) Option {
+	return func(c *Config) { c.Bucket = bucket }
+}
+
+// WithMeasurement sets Config.Measurement.
+func WithMeasurement(measurement string) Option {
+	return func(c *Config) { c.Measurement = measurement }
+}
+
+// WithCollectionInterval sets Config.CollectionInterval.
+func WithCollectionInterval(interval time.Duration) Option {
+	return func(c *Config) { c.CollectionInterval = interval }
+}
+
+// WithTags adds tags to Config.Tags, which is copied so the map of WithConfig is
+// left unchanged.
+func WithTags(tags map[string]string) Option {
+	return func(c *Config) {
+		merged := make(map[string]string, len(c.Tags)+len(tags))
+		for k, v := range c.Tags {
+			merged[k] = v
+		}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		c.Tags = merged
+	}
+}
+
+// WithLogger sets Config.Logger.
+func WithLogger(logger Logger) Option {
+	return func(c *Config) { c.Logger = logger }
+}
@@ -1,13 +1,23 @@
 package metrics
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/cloud"
 	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
 )
 
@@ -17,19 +27,54 @@ const (
 	defaultBucket                  = "stats"
 	defaultCollectionInterval      = 10 * time.Second
 	defaultFlushInterval      uint = 60000 // in ms
+	defaultAllocProfileTopN        = 5
+	defaultUnhealthyThreshold      = 3
+	defaultHealthCheckTimeout      = 5 * time.Second
+	defaultPointBufferSize         = 1000
+	defaultThresholdHeartbeat      = 5 * time.Minute
 )
 
+// InfluxDB flavors, see Config.Flavor
+const (
+	FlavorOSS      = "oss"
+	FlavorCloud    = "cloud"
+	FlavorV1Compat = "1.8"
+)
+
+// hostname is replaced in tests
+var hostname = os.Hostname
+
 type (
 	Config struct {
 		// InfluxDb scheme://host:port
 		// Default is "http://localhost:8086".
 		Addr string
 
+		// Addresses of several InfluxDB servers, every point being written to all of them,
+		// e.g. to mirror the statistics to a disaster recovery cluster. Each server has its
+		// own client buffering and retrying its writes, so a failing one doesn't hold the
+		// points of the others back, and its write errors are logged with its address.
+		// Addr is ignored when set.
+		// Default is nil, which writes to Addr
+		Addrs []string
+
 		AuthToken string
 
-		// Organization
+		// TLS configuration of the connections to InfluxDB over https, e.g. with the RootCAs
+		// of a private CA. Certificate verification can be skipped with InsecureSkipVerify.
+		// Default is nil, which verifies the certificates against the system roots
+		TLSConfig *tls.Config
+
+		// Organization. Whether it may be empty depends on Flavor: InfluxDB Cloud
+		// uses the organization owning AuthToken and InfluxDB 1.8 has no organizations,
+		// while InfluxDB OSS 2.x requires it.
 		Org string
 
+		// Flavor of the InfluxDB server: FlavorOSS, FlavorCloud or FlavorV1Compat,
+		// used to validate Org.
+		// Default is "", which passes Org through unchecked.
+		Flavor string
+
 		// Bucket to write points to.
 		// Default is "statsCollector" and is auto created
 		Bucket string
@@ -51,19 +96,440 @@ type (
 
 		// Disable collecting Memory Statistics. mem.*
 		DisableMem bool
+
+		// Counter keys (e.g. "mem.malloc") to emit both as the cumulative "<key>"
+		// and as the per-interval "<key>_delta".
+		EmitBothCounterForms []string
+
+		// Interval at which the top allocation sites are computed from the memory
+		// profile and written to AllocProfileMeasurement. This is heavyweight and
+		// meant to run every few minutes at most.
+		// Default is 0, which disables it.
+		AllocProfileInterval time.Duration
+
+		// Number of allocation sites to report.
+		// Default is 5.
+		AllocProfileTopN int
+
+		// Measurement to write allocation sites to.
+		// Default is "<Measurement>.alloc_sites".
+		AllocProfileMeasurement string
+
+		// Maximum number of tags on a point, protecting InfluxDB from cardinality explosions.
+		// Default is 0, which means no limit.
+		MaxTags int
+
+		// Drop the tags exceeding MaxTags, in key order, with a warning instead of failing
+		// RunCollector with an error. Without it, points exceeding MaxTags after the
+		// validation, e.g. with late MetadataProvider tags, keep their tags with a warning.
+		// Default is false
+		TruncateTags bool
+
+		// Buckets to write metric categories ("cpu", "mem") to, e.g. to keep high-frequency
+		// cpu statistics in a short-retention bucket. Categories without an entry go to Bucket.
+		CategoryBuckets map[string]string
+
+		// Interval at which to collect points while the process is idle, i.e. the goroutine
+		// count and allocation rate stay within IdleGoroutineThreshold and IdleAllocRateThreshold.
+		// Default is 0, which disables idle detection.
+		IdleInterval time.Duration
+
+		// Largest change of the goroutine count between collections still considered idle.
+		IdleGoroutineThreshold int
+
+		// Highest allocation rate, in bytes per second, still considered idle.
+		// Default is 64 KiB/s.
+		IdleAllocRateThreshold float64
+
+		// Back off the collection interval, doubling it up to MaxCollectionInterval, while
+		// collections take longer than this, e.g. on large heaps. The interval in effect is
+		// reported as "runtime.collect.interval_ns".
+		// Default is 0, which disables the back off.
+		SlowCollectionThreshold time.Duration
+
+		// Longest interval backed off to with SlowCollectionThreshold.
+		// Default is 8 times CollectionInterval
+		MaxCollectionInterval time.Duration
+
+		// Collect an additional point after every completed garbage collection cycle.
+		// Default is false
+		CollectOnGC bool
+
+		// Correct the collection schedule for timer drift so the average interval stays
+		// at CollectionInterval on long-running, loaded processes.
+		// Default is false
+		CorrectIntervalDrift bool
+
+		// Delay before the first collection, letting the application finish warming up.
+		// Default is 0
+		StartDelay time.Duration
+
+		// Emit a "seq" field incremented by one per collection, so dashboards and alerts
+		// can detect missing points. It restarts at 1 with the process.
+		// Default is false
+		EmitSequence bool
+
+		// Interval at which the InfluxDB health endpoint is polled. After UnhealthyThreshold
+		// consecutive failed checks the client and write APIs are recreated.
+		// Default is 0, which disables health checks.
+		HealthCheckInterval time.Duration
+
+		// Number of consecutive failed health checks before reconnecting.
+		// Default is 3
+		UnhealthyThreshold int
+
+		// Timeout of a health check, after which it counts as failed.
+		// Default is 5 seconds
+		HealthCheckTimeout time.Duration
+
+		// Delay before re-attempting a failed write. The write API keeps failed batches and
+		// grows the delay exponentially with consecutive failures, up to SinkMaxRetryBackoff,
+		// independently of CollectionInterval.
+		// Default is the client default, 5 seconds
+		SinkRetryBackoff time.Duration
+
+		// Upper bound of the delay between write attempts.
+		// Default is the client default, 5 minutes
+		SinkMaxRetryBackoff time.Duration
+
+		// Number of times a failed write is re-attempted before its points are discarded.
+		// The failed batches are kept and re-attempted along with the following writes.
+		// There is no separate backoff for these retries: they reuse SinkRetryBackoff and
+		// SinkMaxRetryBackoff. A negative value disables retries.
+		// Default is the client default, 3
+		WriteRetries int
+
+		// Provider of additional tags describing the environment, e.g. the cloud instance id,
+		// zone and region. A failing provider is logged and its tags are skipped. It is
+		// called for every point, on the collection goroutine, so it must return quickly,
+		// e.g. by caching its tags and failures like cloud.IMDS.
+		// Default is nil
+		MetadataProvider cloud.Provider
+
+		// Cloud whose instance metadata service provides the tags when MetadataProvider is
+		// nil: "aws", "gcp" or "azure".
+		// Default is "", which disables it.
+		Cloud string
+
+		// Drop points identical to the previous one (same tags and field values) within a
+		// flush window, writing only the latest of them.
+		// Default is false
+		DeduplicatePoints bool
+
+		// Floor the time of the points to a multiple of DownsampleBucket, e.g. a minute, and
+		// write only the latest point of every series per bucket, downsampling at the edge.
+		// Default is 0, which disables it.
+		DownsampleBucket time.Duration
+
+		// Absolute ceiling of the goroutine count indicating runaway growth. Crossing it writes
+		// a one-time event point to "<Measurement>.events" and calls OnGoroutineHardLimit;
+		// both fire again only after the count dropped back below the ceiling.
+		// Default is 0, which disables it.
+		GoroutineHardLimit int
+
+		// Called with the goroutine count when GoroutineHardLimit is crossed.
+		OnGoroutineHardLimit func(int)
+
+		// Reader of the GODEBUG=gctrace=1 output, e.g. the read end of a pipe the
+		// application redirects its stderr to. Every GC cycle is written as a point to
+		// "<Measurement>.gctrace"; other lines are ignored.
+		// Default is nil
+		GCTraceReader io.Reader
+
+		// Derived metrics to compute and emit, e.g. "mem.alloc_rate", "mem.heap.utilization"
+		// or "<counter>_delta". See collector.DerivedNames for the available rates and ratios.
+		// Default is none
+		DerivedMetrics []string
+
+		// Directory holding state persisted across restarts. When set, points carry a
+		// "restart_epoch" tag incremented on every process start, disambiguating series
+		// across restarts.
+		// Default is "", which disables it.
+		StateDir string
+
+		// Channel triggering an immediate collection whenever it receives a value, in
+		// addition to the collections every CollectionInterval unless TriggerOnly is set.
+		// Default is nil
+		TriggerCh <-chan struct{}
+
+		// Collect only on TriggerCh, disabling the periodic collections.
+		// Default is false
+		TriggerOnly bool
+
+		// Window over which the samples taken every CollectionInterval are aggregated into
+		// a single point, reducing the point volume while preserving extremes. Numeric
+		// values are then written as "<key>_min", "<key>_max" and "<key>_avg".
+		// Default is 0, which writes every sample.
+		AggregationWindow time.Duration
+
+		// Aggregation functions applied with AggregationWindow: AggregateMin, AggregateMax
+		// and AggregateAvg.
+		// Default is all of them
+		AggregationFuncs []string
+
+		// Write a "<Measurement>.exporter" point on every collection, reporting the count,
+		// failures to be retried by the client, bytes sent and latency of the writes to
+		// InfluxDB.
+		// Default is false
+		ExporterMetrics bool
+
+		// Collect and log the points, as line protocol to Logger, instead of writing them,
+		// e.g. for local development without an InfluxDB server. No client is created.
+		// Default is false
+		DryRun bool
+
+		// Write the points which could not be written to InfluxDB, including those of the
+		// final flush on shutdown, as line protocol to DumpWriter so an operator can recover
+		// them from the logs.
+		// Default is false
+		DumpOnFinalFlushFailure bool
+
+		// Stop the collector, as Collector.Stop does, when the process receives SIGINT or
+		// SIGTERM, so the pending points are flushed before it exits. The signal is then
+		// raised again to terminate the process. Applications handling these signals
+		// themselves should call Stop instead.
+		// Default is false
+		FlushOnShutdown bool
+
+		// Writer receiving the points dumped with DumpOnFinalFlushFailure.
+		// Default is os.Stderr
+		DumpWriter io.Writer
+
+		// Emit the given fields only every N collections, starting with the first one,
+		// e.g. {"mem.gc.sys": 6} for slow-changing values. Other fields are emitted on
+		// every collection.
+		// Default is nil
+		FieldSampleEvery map[string]int
+
+		// Emit only the given fields, e.g. {"mem.gc.pause", "mem.heap.alloc"}, to reduce the
+		// storage of the points. Derived values, such as counter deltas, must be listed too.
+		// Default is nil, which emits all fields
+		IncludeFields []string
+
+		// Never emit the given fields. Applied after IncludeFields.
+		// Default is nil
+		ExcludeFields []string
+
+		// Number of buffered points triggering a write, coalescing the points of several
+		// collections into one write. Points are written after at most MaxPointAge even if
+		// fewer are buffered.
+		// Default is 0, which keeps the client batch size of 5000 points.
+		MinFlushPoints int
+
+		// Longest time a point waits in the buffer for MinFlushPoints to be reached. It
+		// replaces FlushInterval as the interval of the periodic writes.
+		// Default is FlushInterval
+		MaxPointAge time.Duration
+
+		// Called with the totals of the run when the collector stops. The summary is also
+		// logged.
+		// Default is nil
+		OnShutdown func(ShutdownSummary)
+
+		// Add values of the runtime/metrics package, available since Go 1.16, such as the
+		// 64-bit "mem.gc.cycles_total" counter.
+		// Default is false
+		RuntimeMetrics bool
+
+		// Static tags added to every point, e.g. {"service": "api", "env": "prod"}. They are
+		// set as default tags of the InfluxDB client, so other tags of a point take
+		// precedence, except the runtime tags (go.os, go.arch, go.version) which are
+		// replaced when explicitly set in Tags.
+		// Default is nil
+		Tags map[string]string
+
+		// Called before every collection, which is skipped, with nothing written, when it
+		// returns false, e.g. to only collect while serving traffic.
+		// Default is nil, which always collects.
+		CollectIf func() bool
+
+		// Called once, when the config is first validated, the returned suffix is appended
+		// to Measurement in the names of the points, after the hostname, e.g. to segment
+		// blue/green deployments. Measurement itself is left as is. An empty suffix is
+		// ignored.
+		// Default is nil
+		MeasurementSuffixFunc func() string
+
+		// Called on every collection, the returned name replaces Measurement for the point
+		// of the collection, e.g. to write the statistics of each tenant to its own
+		// measurement. An empty name falls back to Measurement. Derived points, such as
+		// events and exporter statistics, keep Measurement.
+		// Default is nil
+		MeasurementFunc func(collector.Fields) string
+
+		// Emit the given fields only when their value crosses the threshold, upwards or
+		// downwards, since the previous collection, and as a heartbeat every
+		// ThresholdHeartbeat, e.g. {"cpu.goroutines": 10000} for sparse, alert-driven
+		// storage. Other fields are emitted on every collection.
+		// Default is nil
+		ThresholdCrossings map[string]float64
+
+		// Interval at which the ThresholdCrossings fields are emitted even without crossing.
+		// Default is 5 minutes
+		ThresholdHeartbeat time.Duration
+
+		// Timeout of the reads of process and OS files, such as those in /proc. On timeout,
+		// the last values read are reported again and flagged as stale.
+		// Default is 1 second
+		ProcessReadTimeout time.Duration
+
+		// Tag every point with "interval", the CollectionInterval in seconds, so the
+		// resolution of series collected at different intervals can be told apart.
+		// Default is false
+		IntervalTag bool
+
+		// Tag every point with "source", the backend the statistics were read from:
+		// "memstats", or "runtime_metrics" with RuntimeMetrics, to tell the series apart
+		// while migrating from one to the other.
+		// Default is false
+		SourceTag bool
+
+		// Report the percentiles of the scheduler latencies since the previous collection as
+		// "sched.latency.p50", "sched.latency.p90" and "sched.latency.p99", on Go 1.17 and
+		// later.
+		// Default is false
+		SchedLatency bool
+
+		// Report the percentiles of the GC pauses since the previous collection as
+		// "mem.gc.pause.p50", "mem.gc.pause.p90", "mem.gc.pause.p99" and "mem.gc.pause.max".
+		// Default is false
+		GCPausePercentiles bool
+
+		// Report the memory limit and usage of the cgroup of the process, e.g. the
+		// container, as "mem.cgroup.limit" and "mem.cgroup.usage". Linux only.
+		// Default is false
+		CgroupMem bool
+
+		// Report the CPU usage of the process, user and system, since the previous
+		// collection as "cpu.process.percent", on platforms with getrusage.
+		// Default is false
+		ProcessCPU bool
+
+		// Report the resident set size and the virtual memory size of the process as
+		// "mem.process.rss" and "mem.process.vsize". Linux only.
+		// Default is false
+		ProcessMem bool
+
+		// Report the number of open file descriptors of the process and their soft limit as
+		// "proc.open_fds" and "proc.max_fds". Linux only.
+		// Default is false
+		FDs bool
+
+		// Interval at which the goroutine count is sampled between collections, reported as
+		// "cpu.goroutines.min" and "cpu.goroutines.max" over each collection window.
+		// Default is 0, which only samples it on collection
+		GoroutineSampleInterval time.Duration
+
+		// Number of points buffered between the collector and the InfluxDB client, so a slow
+		// write never blocks the collection. Points are dropped with a warning, and counted
+		// in the ShutdownSummary, while the buffer is full.
+		// Default is 1000
+		PointBufferSize int
+
+		// Returns the timestamp of the written points, e.g. a fixed time for golden-file
+		// tests of the emitted points.
+		// Default is time.Now
+		TimeFunc func() time.Time
+
+		// Receives the warnings and errors of the collector, such as the errors of the
+		// asynchronous writes to InfluxDB.
+		// Default is DefaultLogger
+		Logger Logger
+
+		// measurementSuffix is the result of MeasurementSuffixFunc, resolved by the first
+		// init and appended to Measurement when building the points.
+		measurementSuffix *string
+	}
+
+	// influxClient is the part of influxdb2.Client used by the sender, also implemented
+	// by the fanout and dry run clients.
+	influxClient interface {
+		WriteAPI(org, bucket string) api.WriteAPI
+		Health(ctx context.Context) (*domain.HealthCheck, error)
+		Close()
 	}
 
 	statsSender struct {
-		config   *Config
-		client   influxdb2.Client
-		writeAPI api.WriteAPI
-		pc       chan *write.Point
+		config    *Config
+		newClient func() influxClient
+		pc        chan bucketPoint
+
+		providerErr  string
+		maxTagsOnce  sync.Once
+		restartEpoch string
+		aggregator   *aggregator
+		exporter     *exporterStats
+		failed       *failedWrites
+		ticks        int
+		crossings    map[string]crossing
+		started      time.Time
+		done         chan struct{}
+		wg           sync.WaitGroup
+		stats        senderStats
+
+		unknownFieldsOnce sync.Once
+		bufferFull        int32
+
+		pendingMu sync.Mutex
+		pending   map[string]*write.Point
+
+		mu         sync.RWMutex
+		client     influxClient
+		writeAPI   api.WriteAPI
+		bucketAPIs map[string]api.WriteAPI
 	}
 )
 
-func (config *Config) init() {
-	if config == nil {
-		*config = Config{}
+// init applies the defaults and validates config as setDefaults, then resolves the
+// settings with side effects: MeasurementSuffixFunc is called, the Cloud provider is
+// created and queried for the tags counted against MaxTags.
+func (config *Config) init() error {
+	if config.MeasurementSuffixFunc != nil && config.measurementSuffix == nil {
+		suffix := sanitize(config.MeasurementSuffixFunc())
+		config.measurementSuffix = &suffix
+	}
+
+	if err := config.setDefaults(); err != nil {
+		return err
+	}
+
+	if config.MetadataProvider == nil && config.Cloud != "" {
+		provider, err := cloud.NewIMDS(config.Cloud)
+		if err != nil {
+			return err
+		}
+		config.MetadataProvider = provider
+	}
+
+	// the provider is queried once here so its tags are counted as well; a provider
+	// failing now is retried on the first points, which limitTags then bounds
+	if config.MaxTags <= 0 {
+		return nil
+	}
+	var provided map[string]string
+	if config.MetadataProvider != nil {
+		var err error
+		if provided, err = config.MetadataProvider.Tags(context.Background()); err != nil {
+			config.logger().Printf("metrics: can't count metadata tags against MaxTags: %v", err)
+		}
+	}
+	excess, err := config.checkMaxTags(provided)
+	if err != nil {
+		return err
+	}
+	if excess > 0 {
+		config.logger().Printf("metrics: %d tags exceed MaxTags (%d), dropping %d of them",
+			config.MaxTags+excess, config.MaxTags, excess)
+	}
+	return nil
+}
+
+// setDefaults applies the defaults of config and validates it, without side effects:
+// MeasurementSuffixFunc isn't called, no provider is created or queried and nothing is
+// logged.
+func (config *Config) setDefaults() error {
+	if err := config.checkIntervals(); err != nil {
+		return err
 	}
 
 	if config.Bucket == "" {
@@ -77,10 +543,10 @@ func (config *Config) init() {
 	if config.Measurement == "" {
 		config.Measurement = defaultMeasurement
 
-		if hn, err := os.Hostname(); err != nil {
+		if hn, err := hostname(); err != nil || sanitize(hn) == "" {
 			config.Measurement += ".unknown"
 		} else {
-			config.Measurement += "." + hn
+			config.Measurement += "." + sanitize(hn)
 		}
 	}
 
@@ -91,43 +557,706 @@ func (config *Config) init() {
 	if config.FlushInterval == 0 {
 		config.FlushInterval = defaultFlushInterval
 	}
+
+	if config.AllocProfileInterval > 0 {
+		if config.AllocProfileTopN <= 0 {
+			config.AllocProfileTopN = defaultAllocProfileTopN
+		}
+		if config.AllocProfileMeasurement == "" {
+			config.AllocProfileMeasurement = config.measurement() + ".alloc_sites"
+		}
+	}
+
+	if config.TimeFunc == nil {
+		config.TimeFunc = time.Now
+	}
+
+	if config.DumpOnFinalFlushFailure && config.DumpWriter == nil {
+		config.DumpWriter = os.Stderr
+	}
+
+	if config.HealthCheckInterval > 0 && config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+
+	if config.PointBufferSize <= 0 {
+		config.PointBufferSize = defaultPointBufferSize
+	}
+
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = defaultHealthCheckTimeout
+	}
+
+	if err := config.checkAddr(); err != nil {
+		return err
+	}
+
+	if err := config.checkOrg(); err != nil {
+		return err
+	}
+
+	if err := config.checkAuthToken(); err != nil {
+		return err
+	}
+
+	if config.SinkMaxRetryBackoff > 0 && config.SinkMaxRetryBackoff < config.SinkRetryBackoff {
+		return fmt.Errorf("metrics: SinkMaxRetryBackoff (%s) is lower than SinkRetryBackoff (%s)",
+			config.SinkMaxRetryBackoff, config.SinkRetryBackoff)
+	}
+
+	if config.MetadataProvider == nil && config.Cloud != "" {
+		if _, err := cloud.NewIMDS(config.Cloud); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range config.Tags {
+		if k == "" || v == "" {
+			return fmt.Errorf("metrics: empty tag key or value (%q=%q)", k, v)
+		}
+	}
+
+	if _, err := config.checkMaxTags(nil); err != nil {
+		return err
+	}
+
+	for category, bucket := range config.CategoryBuckets {
+		if !collector.IsCategory(category) {
+			return fmt.Errorf("metrics: unknown category %q", category)
+		}
+		if bucket == "" {
+			return fmt.Errorf("metrics: empty bucket for category %q", category)
+		}
+	}
+
+	if config.TriggerOnly && config.TriggerCh == nil {
+		return fmt.Errorf("metrics: TriggerOnly requires TriggerCh")
+	}
+
+	for _, name := range config.DerivedMetrics {
+		if !collector.IsDerived(name) {
+			return fmt.Errorf("metrics: unknown derived metric %q", name)
+		}
+	}
+
+	for _, key := range config.EmitBothCounterForms {
+		if !collector.IsCounter(key) {
+			return fmt.Errorf("metrics: %q is not a counter", key)
+		}
+	}
+
+	if config.DownsampleBucket < 0 {
+		return fmt.Errorf("metrics: negative DownsampleBucket (%s)", config.DownsampleBucket)
+	}
+
+	if config.MinFlushPoints < 0 {
+		return fmt.Errorf("metrics: negative MinFlushPoints (%d)", config.MinFlushPoints)
+	}
+	if config.MaxPointAge < 0 || config.MaxPointAge > 0 && config.MaxPointAge < time.Millisecond {
+		return fmt.Errorf("metrics: invalid MaxPointAge (%s)", config.MaxPointAge)
+	}
+
+	if len(config.ThresholdCrossings) > 0 && config.ThresholdHeartbeat == 0 {
+		config.ThresholdHeartbeat = defaultThresholdHeartbeat
+	}
+
+	for key, n := range config.FieldSampleEvery {
+		if n <= 0 {
+			return fmt.Errorf("metrics: invalid sample rate %d for %q", n, key)
+		}
+	}
+
+	if config.AggregationWindow > 0 {
+		if config.AggregationWindow < config.CollectionInterval {
+			return fmt.Errorf("metrics: AggregationWindow (%s) is shorter than CollectionInterval (%s)",
+				config.AggregationWindow, config.CollectionInterval)
+		}
+		if len(config.AggregationFuncs) == 0 {
+			config.AggregationFuncs = defaultAggregationFuncs
+		}
+		if err := checkAggregationFuncs(config.AggregationFuncs); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func newStatsSender(config *Config) *statsSender {
-	clientOptions := influxdb2.DefaultOptions().
+// redacted replaces secrets in the effective configuration.
+const redacted = "[REDACTED]"
+
+// Effective returns a copy of config with the defaults applied as RunCollector does,
+// e.g. to debug where points are written to, and the AuthToken and the credentials of
+// the addresses redacted. Invalid settings are left as is, RunCollector reports them.
+// It has no side effects: MeasurementSuffixFunc isn't called and the Cloud provider
+// isn't created, so neither shows in the result.
+func (config Config) Effective() Config {
+	_ = config.setDefaults()
+	if config.AuthToken != "" {
+		config.AuthToken = redacted
+	}
+	config.Addr = redactAddr(config.Addr)
+	if len(config.Addrs) > 0 {
+		addrs := make([]string, len(config.Addrs))
+		for i, addr := range config.Addrs {
+			addrs[i] = redactAddr(addr)
+		}
+		config.Addrs = addrs
+	}
+	return config
+}
+
+// redactAddr replaces the userinfo of addr, which may hold credentials.
+func redactAddr(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		if strings.Contains(addr, "@") {
+			return redacted
+		}
+		return addr
+	}
+	if u.User == nil {
+		return addr
+	}
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+redacted+"@", 1)
+}
+
+// measurement returns Measurement followed by the suffix of MeasurementSuffixFunc.
+func (config *Config) measurement() string {
+	if config.measurementSuffix == nil || *config.measurementSuffix == "" {
+		return config.Measurement
+	}
+	return config.Measurement + "." + *config.measurementSuffix
+}
+
+// derived splits the derived metrics into counter deltas and other derived values.
+func (config *Config) derived() (deltas []string, derived []string) {
+	deltas = append(deltas, config.EmitBothCounterForms...)
+	for _, name := range config.DerivedMetrics {
+		if base := strings.TrimSuffix(name, "_delta"); base != name && collector.IsCounter(base) {
+			deltas = append(deltas, base)
+		} else {
+			derived = append(derived, name)
+		}
+	}
+	return deltas, derived
+}
+
+func (config *Config) checkOrg() error {
+	switch config.Flavor {
+	case "", FlavorCloud, FlavorV1Compat:
+		return nil
+	case FlavorOSS:
+		if config.Org == "" {
+			return fmt.Errorf("metrics: Org is required for InfluxDB OSS 2.x")
+		}
+		return nil
+	default:
+		return fmt.Errorf("metrics: unknown InfluxDB flavor %q", config.Flavor)
+	}
+}
+
+// sanitize replaces every run of characters other than letters, digits, '.', '-'
+// and '_' with a single underscore, so the result is safe to use in measurement
+// names and tag values.
+func sanitize(s string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range s {
+		if isSafeRune(r) {
+			if pending && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pending = false
+			b.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	return b.String()
+}
+
+func isSafeRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '.' || r == '-' || r == '_'
+}
+
+func (config *Config) clientOptions() *influxdb2.Options {
+	options := influxdb2.DefaultOptions().
 		SetFlushInterval(config.FlushInterval).
-		SetUseGZip(true).
-		SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+		SetUseGZip(true)
+
+	if config.TLSConfig != nil {
+		options.SetTLSConfig(config.TLSConfig)
+	}
+
+	if config.MinFlushPoints > 0 {
+		options.SetBatchSize(uint(config.MinFlushPoints))
+	}
+	if config.MaxPointAge > 0 {
+		options.SetFlushInterval(uint(config.MaxPointAge / time.Millisecond))
+	}
+	for k, v := range config.Tags {
+		options.AddDefaultTag(k, v)
+	}
+	if config.SinkRetryBackoff > 0 {
+		options.SetRetryInterval(uint(config.SinkRetryBackoff / time.Millisecond))
+	}
+	if config.SinkMaxRetryBackoff > 0 {
+		options.SetMaxRetryInterval(uint(config.SinkMaxRetryBackoff / time.Millisecond))
+	}
+	switch {
+	case config.WriteRetries > 0:
+		options.SetMaxRetries(uint(config.WriteRetries))
+	case config.WriteRetries < 0:
+		options.SetMaxRetries(0)
+	}
+
+	return options
+}
+
+func newStatsSender(config *Config) *statsSender {
+	clientOptions := config.clientOptions()
 
 	sender := &statsSender{
-		client: influxdb2.NewClientWithOptions(config.Addr, config.AuthToken, clientOptions),
-		config: config,
-		pc:     make(chan *write.Point),
+		config:   config,
+		pc:       make(chan bucketPoint, config.PointBufferSize),
+		started:  time.Now(),
+		done:     make(chan struct{}),
+		exporter: &exporterStats{},
+		newClient: func() influxClient {
+			if addrs := config.addrs(); len(addrs) > 1 {
+				return newFanoutClient(addrs, config.AuthToken, clientOptions)
+			}
+			return influxdb2.NewClientWithOptions(config.addrs()[0], config.AuthToken, clientOptions)
+		},
+	}
+	sender.exporter.instrument(clientOptions.HTTPClient())
+	if config.DryRun {
+		sender.newClient = func() influxClient { return dryRunClient{logger: config.logger()} }
 	}
-	sender.writeAPI = sender.client.WriteAPI(config.Org, config.Bucket)
+	if config.DumpOnFinalFlushFailure {
+		sender.failed = &failedWrites{logger: config.logger()}
+		sender.failed.instrument(clientOptions.HTTPClient())
+	}
+	sender.connect()
 
 	return sender
 }
 
-func RunCollector(config *Config) {
-	config.init()
+// connect creates the client and write APIs, replacing the current ones.
+func (r *statsSender) connect() {
+	client := r.newClient()
+	bucketAPIs := make(map[string]api.WriteAPI, len(r.config.CategoryBuckets))
+	for _, bucket := range r.config.CategoryBuckets {
+		bucketAPIs[bucket] = client.WriteAPI(r.config.Org, bucket)
+		r.logErrors(bucketAPIs[bucket])
+	}
+	writeAPI := client.WriteAPI(r.config.Org, r.config.Bucket)
+	r.logErrors(writeAPI)
 
-	c := collector.New(newStatsSender(config).onNewPoint)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.client = client
+	r.writeAPI = writeAPI
+	r.bucketAPIs = bucketAPIs
+}
+
+// logErrors passes the errors of the asynchronous writes of w to the Logger until the
+// client is closed, which closes the channel. The write API blocks on an error until it
+// is received, so the channel must be drained from its creation on.
+func (r *statsSender) logErrors(w api.WriteAPI) {
+	errs := w.Errors()
+	if errs == nil {
+		return
+	}
+	go func() {
+		for err := range errs {
+			r.config.logger().Printf("metrics: writing points: %v", err)
+		}
+	}()
+}
+
+// close flushes the buffered points and closes the client. With
+// DumpOnFinalFlushFailure, the points which could not be written are dumped to
+// DumpWriter.
+func (r *statsSender) close() {
+	r.flushPending()
+	r.drainPoints()
+
+	r.mu.RLock()
+	client := r.client
+	r.mu.RUnlock()
+	// the async write APIs flush on Close
+	client.Close()
+
+	if r.failed != nil {
+		if err := r.failed.dump(r.config.DumpWriter); err != nil {
+			r.config.logger().Printf("metrics: dumping unwritten points: %v", err)
+		}
+	}
+
+	r.reportShutdown()
+}
+
+// Collector is a running collector, returned by RunCollector and NewCallback.
+type Collector struct {
+	sender    *statsSender
+	collector *collector.Collector
+	stopped   chan struct{}
+	stopOnce  sync.Once
+}
+
+// RunCollector collects runtime statistics every CollectionInterval and writes them to
+// InfluxDB until the returned Collector is stopped. A nil config uses the defaults.
+func RunCollector(config *Config) (*Collector, error) {
+	sender, err := startSender(config)
+	if err != nil {
+		return nil, err
+	}
+	config = sender.config
+
+	c := collector.New(sender.onNewPoint)
 	c.PauseDur = config.CollectionInterval
 	c.EnableCPU = !config.DisableCpu
 	c.EnableMem = !config.DisableMem
+	c.CounterDeltas, c.Derived = config.derived()
+	c.IdlePauseDur = config.IdleInterval
+	c.SlowCollectThreshold = config.SlowCollectionThreshold
+	c.MaxPauseDur = config.MaxCollectionInterval
+	c.IdleGoroutines = config.IdleGoroutineThreshold
+	c.IdleAllocRate = config.IdleAllocRateThreshold
+	c.CollectOnGC = config.CollectOnGC
+	c.CorrectDrift = config.CorrectIntervalDrift
+	c.StartDelay = config.StartDelay
+	c.EmitSeq = config.EmitSequence
+	c.GoroutineLimit = config.GoroutineHardLimit
+	c.Trigger = config.TriggerCh
+	c.TriggerOnly = config.TriggerOnly
+	c.EnableRuntimeMetrics = config.RuntimeMetrics
+	c.CollectIf = config.CollectIf
+	if config.ProcessReadTimeout > 0 {
+		c.ProcessReadTimeout = config.ProcessReadTimeout
+	}
+	c.OnGoroutineLimit = sender.onGoroutineHardLimit
+	c.GoroutineSampleInterval = config.GoroutineSampleInterval
+	c.GCPausePercentiles = config.GCPausePercentiles
+	c.EnableSchedStats = config.SchedLatency
+	c.EnableCgroupMem = config.CgroupMem
+	c.EnableProcessCPU = config.ProcessCPU
+	c.EnableProcessMem = config.ProcessMem
+	c.EnableFDs = config.FDs
+	c.Done = sender.done
+
+	handle := &Collector{sender: sender, collector: c, stopped: make(chan struct{})}
+	go func() {
+		defer close(handle.stopped)
+		c.Run()
+	}()
+	if config.FlushOnShutdown {
+		handle.stopOnShutdown()
+	}
 
-	go c.Run()
+	return handle, nil
+}
+
+// RunCollectorWithContext works like RunCollector but stops the collector, as Stop does,
+// once ctx is done.
+func RunCollectorWithContext(ctx context.Context, config *Config) error {
+	c, err := RunCollector(config)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+	return nil
+}
+
+// NewCallback works like RunCollector but, instead of running its own collector,
+// the returned Collector provides the Callback writing the statistics to InfluxDB, to
+// be fed by a collector shared with other exporters, so the runtime statistics are
+// only gathered once:
+//
+//	sender, err := metrics.NewCallback(&metrics.Config{})
+//	if err != nil {
+//		// handle error
+//	}
+//	defer sender.Stop()
+//	c := collector.New(collector.Multiplex(sender.Callback(), questdbExporter.Callback()))
+//	go c.Run()
+//
+// The collection settings of config, such as CollectionInterval, DerivedMetrics or
+// GoroutineHardLimit, are left to the shared collector.
+func NewCallback(config *Config) (*Collector, error) {
+	sender, err := startSender(config)
+	if err != nil {
+		return nil, err
+	}
+	config = sender.config
+
+	stopped := make(chan struct{})
+	close(stopped)
+	handle := &Collector{sender: sender, stopped: stopped}
+	if config.FlushOnShutdown {
+		handle.stopOnShutdown()
+	}
+	return handle, nil
+}
+
+// Callback returns the callback writing collected statistics to InfluxDB.
+func (c *Collector) Callback() collector.CollectStatsCallback {
+	return c.sender.onNewPoint
+}
+
+// AddCallback registers a callback receiving every Fields collected by RunCollector,
+// e.g. to feed a logging or alerting pipeline. A Collector returned by NewCallback
+// doesn't own a collector, register the callbacks on the shared one instead.
+func (c *Collector) AddCallback(callback collector.CollectStatsCallback) {
+	if c.collector != nil {
+		c.collector.AddCallback(callback)
+	}
+}
+
+// LastWriteError returns the error of the last write request to InfluxDB, nil if it
+// succeeded or before the first write.
+func (c *Collector) LastWriteError() error {
+	return c.sender.exporter.lastError()
+}
+
+// PointsWritten returns the number of points InfluxDB accepted so far, as reported by
+// ShutdownSummary.PointsWritten. Points waiting in the batches of the client, or whose
+// write failed, are not counted.
+func (c *Collector) PointsWritten() uint64 {
+	return uint64(c.sender.summary().PointsWritten)
+}
+
+// Collections returns the number of collections received so far.
+func (c *Collector) Collections() uint64 {
+	return uint64(atomic.LoadInt64(&c.sender.stats.collected))
+}
+
+// Stop stops the collection and the background goroutines, flushes the pending points
+// and closes the InfluxDB client. It may be called more than once.
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.sender.done)
+		<-c.stopped
+		c.sender.wg.Wait()
+		c.sender.close()
+	})
+}
+
+// startSender validates config and starts a sender with its background goroutines.
+func startSender(config *Config) (*statsSender, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if err := config.init(); err != nil {
+		return nil, err
+	}
+
+	sender := newStatsSender(config)
+	if config.StateDir != "" {
+		sender.restartEpoch = strconv.FormatInt(nextRestartEpoch(config.StateDir, config.logger()), 10)
+	}
+	if config.AggregationWindow > 0 {
+		sender.aggregator = newAggregator(config.AggregationWindow, config.AggregationFuncs)
+	}
+
+	if config.GCTraceReader != nil {
+		// the read may block until the process exits, Stop doesn't wait for it
+		go sender.runGCTrace()
+	}
+
+	sender.goBackground(sender.runPointBuffer)
+
+	if config.DeduplicatePoints || config.DownsampleBucket > 0 {
+		sender.goBackground(sender.runDeduplication)
+	}
+
+	if config.HealthCheckInterval > 0 {
+		sender.goBackground(sender.runHealthCheck)
+	}
+
+	if config.AllocProfileInterval > 0 {
+		profiler := collector.NewAllocProfiler(config.AllocProfileTopN)
+		sender.goBackground(func() { sender.runAllocProfiler(profiler) })
+	}
+
+	return sender, nil
 }
 
 func (r *statsSender) onNewPoint(fields collector.Fields) {
-	p := influxdb2.NewPointWithMeasurement(r.config.Measurement)
-	for k, v := range fields.Tags() {
+	atomic.AddInt64(&r.stats.collected, 1)
+	values := fields.Values()
+	now := r.config.TimeFunc()
+
+	r.filterFields(values)
+	for key, n := range r.config.FieldSampleEvery {
+		if r.ticks%n != 0 {
+			delete(values, key)
+		}
+	}
+	r.ticks++
+	r.filterCrossings(values, now)
+
+	if r.aggregator != nil {
+		var ok bool
+		if values, ok = r.aggregator.add(values, now); !ok {
+			return
+		}
+	}
+
+	r.writeValues(r.measurement(fields), r.tags(fields), values, now)
+
+	if r.config.ExporterMetrics {
+		if p := r.exporter.point(r.config.measurement()+".exporter", now); p != nil {
+			r.writePoint(r.config.Bucket, p)
+		}
+	}
+}
+
+// measurement returns the measurement of the point of fields.
+func (r *statsSender) measurement(fields collector.Fields) string {
+	if r.config.MeasurementFunc != nil {
+		if name := r.config.MeasurementFunc(fields); name != "" {
+			return name
+		}
+	}
+	return r.config.measurement()
+}
+
+// writeValues writes values with tags at now to measurement, one point per destination
+// bucket.
+func (r *statsSender) writeValues(measurement string, tags map[string]string, values map[string]interface{}, now time.Time) {
+	points := make(map[string]*write.Point, 1+len(r.config.CategoryBuckets))
+	for k, v := range values {
+		bucket := r.bucketFor(k)
+		p, ok := points[bucket]
+		if !ok {
+			p = influxdb2.NewPointWithMeasurement(measurement)
+			for tk, tv := range tags {
+				p.AddTag(tk, tv)
+			}
+			p.SetTime(now)
+			points[bucket] = p
+		}
+		p.AddField(k, collector.Typed(k, v))
+	}
+
+	for bucket, p := range points {
+		r.write(bucket, p)
+	}
+}
+
+func (r *statsSender) onGoroutineHardLimit(n int) {
+	p := influxdb2.NewPointWithMeasurement(r.config.measurement()+".events").
+		AddTag("event", "goroutine_hard_limit").
+		AddField("goroutines", int64(n)).
+		AddField("limit", int64(r.config.GoroutineHardLimit)).
+		SetTime(r.config.TimeFunc())
+	r.writePoint(r.config.Bucket, p)
+
+	if r.config.OnGoroutineHardLimit != nil {
+		r.config.OnGoroutineHardLimit(n)
+	}
+}
+
+func (r *statsSender) runGCTrace() {
+	if err := collector.ReadGCTrace(r.config.GCTraceReader, r.onGCTrace); err != nil {
+		r.config.logger().Printf("metrics: reading gctrace: %v", err)
+	}
+}
+
+func (r *statsSender) onGCTrace(t collector.GCTrace) {
+	p := influxdb2.NewPointWithMeasurement(r.config.measurement()+".gctrace").
+		AddField("mem.gc.trace.num", t.Num).
+		AddField("mem.gc.trace.pause", int64(t.Pause)).
+		AddField("mem.gc.trace.heap_start", t.HeapStart).
+		AddField("mem.gc.trace.heap_end", t.HeapEnd).
+		AddField("mem.gc.trace.heap_live", t.HeapLive).
+		AddField("mem.gc.trace.heap_goal", t.HeapGoal).
+		AddField("mem.gc.trace.cpu_percent", int64(t.CPUPercent)).
+		AddField("mem.gc.trace.forced", t.Forced).
+		SetTime(r.config.TimeFunc())
+	for k, v := range r.tags(runtimeFields()) {
 		p.AddTag(k, v)
 	}
-	for k, v := range fields.Values() {
-		p.AddField(k, v)
+	r.writePoint(r.config.Bucket, p)
+}
+
+func (r *statsSender) bucketFor(key string) string {
+	if bucket, ok := r.config.CategoryBuckets[collector.Category(key)]; ok {
+		return bucket
+	}
+	return r.config.Bucket
+}
+
+// goBackground runs f in a goroutine awaited by Stop.
+func (r *statsSender) goBackground(f func()) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f()
+	}()
+}
+
+// every calls f every d until the sender is stopped.
+func (r *statsSender) every(d time.Duration, f func()) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			f()
+		}
+	}
+}
+
+// writePoint hands p to the write API of bucket, through the point buffer if any.
+func (r *statsSender) writePoint(bucket string, p *write.Point) {
+	if r.pc != nil {
+		r.bufferPoint(bucket, p)
+		return
+	}
+	r.writeAPIFor(bucket).WritePoint(p)
+}
+
+func (r *statsSender) writeAPIFor(bucket string) api.WriteAPI {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if w, ok := r.bucketAPIs[bucket]; ok {
+		return w
+	}
+	return r.writeAPI
+}
+
+func (r *statsSender) runAllocProfiler(profiler *collector.AllocProfiler) {
+	profiler.Snapshot()
+	r.every(r.config.AllocProfileInterval, func() {
+		r.onAllocSites(profiler.Snapshot())
+	})
+}
+
+func (r *statsSender) onAllocSites(sites []collector.AllocSite) {
+	if len(sites) == 0 {
+		return
+	}
+
+	p := influxdb2.NewPointWithMeasurement(r.config.AllocProfileMeasurement)
+	for i, site := range sites {
+		prefix := "site." + strconv.Itoa(i+1)
+		p.AddField(prefix+".name", site.Name)
+		p.AddField(prefix+".bytes", site.Bytes)
 	}
-	p.SetTime(time.Now())
-	r.writeAPI.WritePoint(p)
+	p.SetTime(r.config.TimeFunc())
+	r.writePoint(r.config.Bucket, p)
 }
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+const sentinelField = "sentinel"
+
+// SelfTest writes a sentinel point to "<Measurement>.selftest" in the configured bucket
+// and reads it back with a Flux query, verifying that points are not only accepted but
+// also queryable. It returns the value observed by the query.
+func SelfTest(ctx context.Context, config *Config) (int64, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if err := config.init(); err != nil {
+		return 0, err
+	}
+
+	client := influxdb2.NewClientWithOptions(config.addrs()[0], config.AuthToken, config.clientOptions())
+	defer client.Close()
+
+	return roundTrip(ctx, client.WriteAPIBlocking(config.Org, config.Bucket), client.QueryAPI(config.Org),
+		config.Bucket, config.measurement()+".selftest")
+}
+
+func roundTrip(ctx context.Context, w api.WriteAPIBlocking, q api.QueryAPI, bucket, measurement string) (int64, error) {
+	now := time.Now()
+	sentinel := now.UnixNano()
+
+	p := influxdb2.NewPointWithMeasurement(measurement).
+		AddField(sentinelField, sentinel).
+		SetTime(now)
+	if err := w.WritePoint(ctx, p); err != nil {
+		return 0, fmt.Errorf("metrics: self-test write: %v", err)
+	}
+
+	flux := fmt.Sprintf(`from(bucket: %q)
+  |> range(start: -1h)
+  |> filter(fn: (r) => r._measurement == %q and r._field == %q)
+  |> last()`, bucket, measurement, sentinelField)
+	result, err := q.QueryRaw(ctx, flux, &domain.Dialect{Header: boolPtr(true)})
+	if err != nil {
+		return 0, fmt.Errorf("metrics: self-test query: %v", err)
+	}
+
+	observed, err := lastValue(result)
+	if err != nil {
+		return 0, fmt.Errorf("metrics: self-test query: %v", err)
+	}
+	if observed != sentinel {
+		return observed, fmt.Errorf("metrics: self-test read back %d, wrote %d", observed, sentinel)
+	}
+	return observed, nil
+}
+
+// lastValue returns the _value column of the last row of a CSV query result.
+func lastValue(result string) (int64, error) {
+	r := csv.NewReader(strings.NewReader(result))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	column := -1
+	var value string
+	for _, record := range records {
+		if column < 0 {
+			for i, name := range record {
+				if name == "_value" {
+					column = i
+				}
+			}
+			continue
+		}
+		if column < len(record) {
+			value = record[column]
+		}
+	}
+
+	if column < 0 || value == "" {
+		return 0, fmt.Errorf("sentinel not found")
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+type mockBlockingWriteAPI struct {
+	points []*write.Point
+}
+
+func (m *mockBlockingWriteAPI) WriteRecord(context.Context, ...string) error { return nil }
+func (m *mockBlockingWriteAPI) WritePoint(_ context.Context, points ...*write.Point) error {
+	m.points = append(m.points, points...)
+	return nil
+}
+
+type mockQueryAPI struct {
+	api.QueryAPI
+	result func() string
+}
+
+func (m *mockQueryAPI) QueryRaw(context.Context, string, *domain.Dialect) (string, error) {
+	return m.result(), nil
+}
+
+func TestSelfTestRoundTrip(t *testing.T) {
+	w := &mockBlockingWriteAPI{}
+	q := &mockQueryAPI{result: func() string {
+		value := w.points[len(w.points)-1].FieldList()[0].Value
+		return fmt.Sprintf(",result,table,_start,_stop,_time,_value,_field,_measurement\r\n"+
+			",_result,0,2021-01-01T00:00:00Z,2021-01-01T01:00:00Z,2021-01-01T00:30:00Z,%v,sentinel,m\r\n\r\n", value)
+	}}
+
+	observed, err := roundTrip(context.Background(), w, q, "stats", "m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp := w.points[0].FieldList()[0].Value; observed != exp {
+		t.Errorf("unexpected observed value:\ngot: %d\nexp: %v", observed, exp)
+	}
+
+	q.result = func() string {
+		return ",result,table,_value\r\n,_result,0,42\r\n"
+	}
+	if _, err := roundTrip(context.Background(), w, q, "stats", "m"); err == nil {
+		t.Error("expected error for mismatching sentinel")
+	}
+
+	q.result = func() string { return "" }
+	if _, err := roundTrip(context.Background(), w, q, "stats", "m"); err == nil {
+		t.Error("expected error for missing sentinel")
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdownSignals are the signals handled with FlushOnShutdown.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// raise delivers sig to the process again, once its handler is removed.
+var raise = func(sig os.Signal) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// stopOnShutdown stops c when the process receives one of the shutdown signals, then
+// raises the signal again so the process terminates as it would have without the
+// handler.
+func (c *Collector) stopOnShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, shutdownSignals...)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-c.sender.done:
+		case sig := <-signals:
+			c.Stop()
+			signal.Stop(signals)
+			if err := raise(sig); err != nil {
+				os.Exit(1)
+			}
+		}
+	}()
+}
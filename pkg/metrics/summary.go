@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// ShutdownSummary holds the totals of a run, reported when the collector stops.
+	ShutdownSummary struct {
+		// Collections is the number of collections handed to the sender.
+		Collections int64
+
+		// PointsWritten is the number of points InfluxDB accepted, counted from the write
+		// requests answered with a 2xx status.
+		PointsWritten int64
+
+		// PointsDropped is the number of points discarded before reaching the client
+		// because the point buffer was full.
+		PointsDropped int64
+
+		// PointsDeduplicated is the number of points superseded by a later point of the
+		// same series with DeduplicatePoints or DownsampleBucket, and never written.
+		PointsDeduplicated int64
+
+		// WriteErrors is the number of failed write requests to InfluxDB.
+		WriteErrors int64
+
+		// Reconnects is the number of times the client was recreated by the health check.
+		Reconnects int64
+
+		// Uptime is the time since RunCollector started.
+		Uptime time.Duration
+	}
+
+	// senderStats counts the activity of a statsSender, accessed atomically.
+	senderStats struct {
+		collected    int64
+		dropped      int64
+		deduplicated int64
+		reconnects   int64
+	}
+)
+
+func (r *statsSender) summary() ShutdownSummary {
+	s := ShutdownSummary{
+		Collections:        atomic.LoadInt64(&r.stats.collected),
+		PointsDropped:      atomic.LoadInt64(&r.stats.dropped),
+		PointsDeduplicated: atomic.LoadInt64(&r.stats.deduplicated),
+		Reconnects:         atomic.LoadInt64(&r.stats.reconnects),
+		Uptime:             time.Since(r.started),
+	}
+	if r.exporter != nil {
+		r.exporter.mu.Lock()
+		s.PointsWritten = r.exporter.points
+		s.WriteErrors = r.exporter.failures
+		r.exporter.mu.Unlock()
+	}
+	return s
+}
+
+// reportShutdown logs the summary of the run, and passes it to OnShutdown.
+func (r *statsSender) reportShutdown() {
+	s := r.summary()
+	r.config.logger().Printf("metrics: stopped after %s: %d collections, %d points written, %d dropped, %d deduplicated, %d write errors, %d reconnects",
+		s.Uptime.Round(time.Millisecond), s.Collections, s.PointsWritten, s.PointsDropped, s.PointsDeduplicated, s.WriteErrors, s.Reconnects)
+
+	if r.config.OnShutdown != nil {
+		r.config.OnShutdown(s)
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+// tags returns the tag set of a point built from fields, limited to MaxTags.
+func (r *statsSender) tags(fields collector.Fields) map[string]string {
+	tags := fields.Tags()
+	// the static Tags are client default tags, which never replace a point tag, so the
+	// runtime tags they explicitly override are set on the point
+	for k := range tags {
+		if v, ok := r.config.Tags[k]; ok {
+			tags[k] = v
+		}
+	}
+	if r.restartEpoch != "" {
+		tags["restart_epoch"] = r.restartEpoch
+	}
+	if r.config.SourceTag && fields.Source != "" {
+		tags["source"] = fields.Source
+	}
+	if r.config.IntervalTag {
+		tags["interval"] = strconv.FormatFloat(r.config.CollectionInterval.Seconds(), 'f', -1, 64)
+	}
+	for k, v := range r.providerTags() {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+	return r.limitTags(tags)
+}
+
+// providerTags returns the tags of the configured MetadataProvider. The tags of a
+// failing provider are skipped, its error is logged whenever it changes, e.g. on every
+// failed cloud.IMDS lookup but not for the cached failure returned in between.
+func (r *statsSender) providerTags() map[string]string {
+	if r.config.MetadataProvider == nil {
+		return nil
+	}
+
+	tags, err := r.config.MetadataProvider.Tags(context.Background())
+	if err != nil {
+		if err.Error() != r.providerErr {
+			r.providerErr = err.Error()
+			r.config.logger().Printf("metrics: skipping metadata tags: %v", err)
+		}
+		return nil
+	}
+	r.providerErr = ""
+	return tags
+}
+
+// limitTags bounds tags to MaxTags, leaving room for the static Tags the client adds
+// to the point. With TruncateTags, the tags exceeding it are dropped in key order;
+// otherwise they are kept and the overflow is logged once.
+func (r *statsSender) limitTags(tags map[string]string) map[string]string {
+	config := r.config
+	if config.MaxTags <= 0 {
+		return tags
+	}
+	static := len(config.staticTags(tags))
+	limit := config.MaxTags - static
+	if limit < 0 {
+		limit = 0
+	}
+	if len(tags) <= limit {
+		return tags
+	}
+
+	if !config.TruncateTags {
+		r.maxTagsOnce.Do(func() {
+			config.logger().Printf("metrics: %d tags exceed MaxTags (%d), set TruncateTags to drop them",
+				len(tags)+static, config.MaxTags)
+		})
+		return tags
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[limit:] {
+		delete(tags, k)
+	}
+	return tags
+}
+
+// staticTags returns the static Tags not overridden by tags.
+func (config *Config) staticTags(tags map[string]string) map[string]string {
+	static := make(map[string]string, len(config.Tags))
+	for k, v := range config.Tags {
+		if _, ok := tags[k]; !ok {
+			static[k] = v
+		}
+	}
+	return static
+}
+
+// checkMaxTags validates the combined tag set, with the provided metadata tags, against
+// MaxTags according to TruncateTags. It returns the number of tags dropped from the
+// points when they are truncated.
+func (config *Config) checkMaxTags(provided map[string]string) (excess int, err error) {
+	if config.MaxTags <= 0 {
+		return 0, nil
+	}
+
+	fields := runtimeFields()
+	tags := fields.Tags()
+	if config.IntervalTag {
+		tags["interval"] = ""
+	}
+	if config.SourceTag {
+		tags["source"] = ""
+	}
+	if config.StateDir != "" {
+		tags["restart_epoch"] = ""
+	}
+	for k := range provided {
+		tags[k] = ""
+	}
+	n := len(tags) + len(config.staticTags(tags))
+	if n <= config.MaxTags {
+		return 0, nil
+	}
+
+	if !config.TruncateTags {
+		return 0, fmt.Errorf("metrics: %d tags exceed MaxTags (%d)", n, config.MaxTags)
+	}
+	return n - config.MaxTags, nil
+}
+
+// runtimeFields returns Fields carrying only the runtime tags, for points not built
+// from a collection.
+func runtimeFields() collector.Fields {
+	return collector.Fields{Goos: runtime.GOOS, Goarch: runtime.GOARCH, Version: runtime.Version()}
+}
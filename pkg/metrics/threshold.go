@@ -0,0 +1,36 @@
+package metrics
+
+import "time"
+
+// crossing is the state of a field emitted on threshold crossings.
+type crossing struct {
+	above   bool
+	emitted time.Time
+}
+
+// filterCrossings removes the ThresholdCrossings fields from values, unless their
+// value crossed the threshold since the previous collection or the heartbeat is due.
+// The first value of a field is always kept.
+func (r *statsSender) filterCrossings(values map[string]interface{}, now time.Time) {
+	if len(r.config.ThresholdCrossings) == 0 {
+		return
+	}
+	if r.crossings == nil {
+		r.crossings = make(map[string]crossing, len(r.config.ThresholdCrossings))
+	}
+
+	for key, threshold := range r.config.ThresholdCrossings {
+		v, _, ok := number(values[key])
+		if !ok {
+			continue
+		}
+
+		above := v >= threshold
+		prev, seen := r.crossings[key]
+		if seen && prev.above == above && now.Sub(prev.emitted) < r.config.ThresholdHeartbeat {
+			delete(values, key)
+			continue
+		}
+		r.crossings[key] = crossing{above: above, emitted: now}
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Validate reports the first invalid setting of config, with the error RunCollector
+// would return: an Addr which is not an http or https URL, a negative interval, an
+// AuthToken or Org missing for the Flavor, or any other inconsistent setting. config
+// is left unchanged and, as for Effective, MeasurementSuffixFunc isn't called and the
+// Cloud provider isn't queried, so its tags aren't counted against MaxTags.
+//
+// The InfluxDB 2.x flavors require AuthToken, and FlavorOSS also requires Org while
+// InfluxDB Cloud uses the organization of the token. Neither is checked with an empty
+// Flavor, as the server may be InfluxDB 1.8. An empty Bucket is valid for every
+// flavor, it selects the default bucket.
+func (config Config) Validate() error {
+	return config.setDefaults()
+}
+
+// checkAddr reports an address which is not an absolute http or https URL.
+func (config *Config) checkAddr() error {
+	for _, addr := range config.addrs() {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("metrics: invalid Addr: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("metrics: invalid Addr %q, expected scheme://host:port with scheme http or https", addr)
+		}
+	}
+	return nil
+}
+
+// addrs returns the addresses of the InfluxDB servers written to, Addrs or Addr.
+func (config *Config) addrs() []string {
+	if len(config.Addrs) > 0 {
+		return config.Addrs
+	}
+	return []string{config.Addr}
+}
+
+// checkAuthToken reports a missing AuthToken for the flavors requiring one. InfluxDB 1.8
+// accepts unauthenticated writes.
+func (config *Config) checkAuthToken() error {
+	if config.AuthToken == "" && (config.Flavor == FlavorOSS || config.Flavor == FlavorCloud) {
+		return fmt.Errorf("metrics: AuthToken is required for InfluxDB flavor %q", config.Flavor)
+	}
+	return nil
+}
+
+// checkIntervals reports negative intervals, 0 selects their default or disables them.
+func (config *Config) checkIntervals() error {
+	for _, interval := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"CollectionInterval", config.CollectionInterval},
+		{"AllocProfileInterval", config.AllocProfileInterval},
+		{"IdleInterval", config.IdleInterval},
+		{"SlowCollectionThreshold", config.SlowCollectionThreshold},
+		{"MaxCollectionInterval", config.MaxCollectionInterval},
+		{"StartDelay", config.StartDelay},
+		{"HealthCheckInterval", config.HealthCheckInterval},
+		{"HealthCheckTimeout", config.HealthCheckTimeout},
+		{"SinkRetryBackoff", config.SinkRetryBackoff},
+		{"SinkMaxRetryBackoff", config.SinkMaxRetryBackoff},
+		{"AggregationWindow", config.AggregationWindow},
+		{"ThresholdHeartbeat", config.ThresholdHeartbeat},
+		{"ProcessReadTimeout", config.ProcessReadTimeout},
+		{"GoroutineSampleInterval", config.GoroutineSampleInterval},
+	} {
+		if interval.d < 0 {
+			return fmt.Errorf("metrics: negative %s (%s)", interval.name, interval.d)
+		}
+	}
+	return nil
+}
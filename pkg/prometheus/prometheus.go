@@ -0,0 +1,174 @@
+// Package prometheus exposes runtime metrics to Prometheus in its text exposition
+// format, without depending on the Prometheus client library.
+//
+// The metrics can't be registered as a prometheus.Collector with a
+// *prometheus.Registry: github.com/prometheus/client_golang is not a dependency of the
+// module. Exporter is an http.Handler to mount next to, or instead of, the handler of
+// the registry.
+//
+//	e, err := prometheus.RunCollector(&prometheus.Config{})
+//	if err != nil {
+//		// handle error
+//	}
+//	defer e.Stop()
+//	http.Handle("/metrics", e)
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+const (
+	defaultNamespace          = "go_runtime"
+	defaultCollectionInterval = 10 * time.Second
+
+	// ContentType is the content type of the text exposition format served by Exporter.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Config configures RunCollector.
+type Config struct {
+	// Namespace prefixes every metric name.
+	// Default is "go_runtime".
+	Namespace string
+
+	// CollectionInterval is the interval between collections.
+	// Default is 10s.
+	CollectionInterval time.Duration
+}
+
+// Exporter is an http.Handler serving the last collected statistics. Every value of
+// Fields.Values is a metric named after its dotted key, e.g. mem.heap.alloc is served
+// as go_runtime_mem_heap_alloc, typed as a counter or a gauge according to the
+// collector metadata. Fields.Tags are served as labels. Boolean values are served as
+// 0 or 1, string values are omitted. It is safe for concurrent use.
+type Exporter struct {
+	namespace string
+
+	mu     sync.Mutex
+	fields *collector.Fields
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New returns an Exporter serving the statistics passed to its Callback, for use with
+// a collector shared with other exporters.
+func New(namespace string) *Exporter {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return &Exporter{namespace: metricName(namespace), done: make(chan struct{})}
+}
+
+// RunCollector runs a collector every CollectionInterval feeding the returned Exporter
+// until it is stopped.
+func RunCollector(config *Config) (*Exporter, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.CollectionInterval < 0 {
+		return nil, fmt.Errorf("prometheus: negative CollectionInterval %s", config.CollectionInterval)
+	}
+
+	e := New(config.Namespace)
+	c := collector.New(e.Callback())
+	if config.CollectionInterval > 0 {
+		c.PauseDur = config.CollectionInterval
+	} else {
+		c.PauseDur = defaultCollectionInterval
+	}
+	c.Done = e.done
+	go c.Run()
+
+	return e, nil
+}
+
+// Callback returns a collector.CollectStatsCallback replacing the served statistics.
+func (e *Exporter) Callback() collector.CollectStatsCallback {
+	return func(fields collector.Fields) {
+		e.mu.Lock()
+		e.fields = &fields
+		e.mu.Unlock()
+	}
+}
+
+// Stop stops the collector started by RunCollector. It may be called more than once.
+func (e *Exporter) Stop() {
+	e.stopOnce.Do(func() { close(e.done) })
+}
+
+// ServeHTTP writes the last collected statistics, nothing before the first collection.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	fields := e.fields
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", ContentType)
+	if fields == nil {
+		return
+	}
+	w.Write(e.format(fields))
+}
+
+func (e *Exporter) format(fields *collector.Fields) []byte {
+	labels := formatLabels(fields.Tags())
+	values := fields.Values()
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		value, ok := collector.FormatValue(k, values[k])
+		if !ok {
+			continue
+		}
+
+		kind := collector.Gauge
+		if m, ok := collector.Lookup(k); ok {
+			kind = m.Kind
+		}
+		name := e.namespace + "_" + metricName(k)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n%s%s %s\n", name, kind, name, labels, value)
+	}
+	return buf.Bytes()
+}
+
+func formatLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, metricName(k)+`="`+labelEscaper.Replace(v)+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName replaces the characters not allowed in metric and label names, such as
+// the dots of the keys, with underscores.
+func metricName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
@@ -0,0 +1,81 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+func TestExporter(t *testing.T) {
+	e := New("")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no metrics before the first collection, got:\n%s", rec.Body)
+	}
+
+	e.Callback()(collector.Fields{
+		NumGoroutine: 3,
+		NumGC:        7,
+		Goos:         "linux",
+		Goarch:       "amd64",
+		Version:      `go"1`,
+		Extra:        map[string]interface{}{"mem.stale": true, "note": "skipped"},
+	})
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("unexpected content type:\ngot: %s\nexp: %s", ct, ContentType)
+	}
+
+	labels := `{go_arch="amd64",go_os="linux",go_version="go\"1"}`
+	body := rec.Body.String()
+	for _, exp := range []string{
+		"# TYPE go_runtime_cpu_goroutines gauge\ngo_runtime_cpu_goroutines" + labels + " 3\n",
+		"# TYPE go_runtime_mem_gc_count counter\ngo_runtime_mem_gc_count" + labels + " 7\n",
+		"go_runtime_mem_gc_cpu_fraction" + labels + " 0\n",
+		"go_runtime_mem_stale" + labels + " 1\n",
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("expected %q in:\n%s", exp, body)
+		}
+	}
+	if strings.Contains(body, "note") {
+		t.Errorf("expected string values to be omitted:\n%s", body)
+	}
+}
+
+func TestRunCollector(t *testing.T) {
+	if _, err := RunCollector(&Config{CollectionInterval: -1}); err == nil {
+		t.Error("expected error for negative CollectionInterval")
+	}
+
+	e, err := RunCollector(&Config{Namespace: "app.runtime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if body := rec.Body.String(); body != "" {
+			if !strings.Contains(body, "app_runtime_cpu_goroutines") {
+				t.Errorf("expected the namespace prefix:\n%s", body)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no collection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	e.Stop()
+}
@@ -0,0 +1,101 @@
+// Package questdb writes runtime metrics to QuestDB using the InfluxDB line protocol
+// (ILP) over TCP.
+//
+// QuestDB also accepts line protocol on its HTTP port, so metrics.RunCollector can
+// write to it directly with DefaultHTTPAddr as Config.Addr.
+package questdb
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/lineprotocol"
+)
+
+const (
+	// DefaultILPAddr is the address of the QuestDB line protocol TCP listener.
+	DefaultILPAddr = "localhost:9009"
+
+	// DefaultHTTPAddr is the address of the QuestDB HTTP server.
+	DefaultHTTPAddr = "http://localhost:9000"
+
+	defaultTable = "go_runtime"
+)
+
+// Exporter writes collected statistics as rows of a QuestDB table. QuestDB rejects
+// dots in table and column names, so they are replaced with underscores, e.g.
+// mem.heap.alloc is written to the mem_heap_alloc column. It is safe for concurrent use.
+type Exporter struct {
+	// Table the rows are written to. Defaults to "go_runtime".
+	Table string
+
+	// ServerTimestamp leaves the designated timestamp of the rows to the server, which
+	// then uses its clock at ingestion. By default, the collection time is sent as the
+	// designated timestamp.
+	ServerTimestamp bool
+
+	// Logger receives the write errors of Callback. Defaults to the standard logger.
+	Logger Logger
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  *bufio.Writer
+}
+
+// Dial connects to the QuestDB line protocol listener at addr, DefaultILPAddr if empty.
+func Dial(addr string) (*Exporter, error) {
+	if addr == "" {
+		addr = DefaultILPAddr
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{Table: defaultTable, conn: conn, buf: bufio.NewWriter(conn)}, nil
+}
+
+// Write writes fields collected at t as one row.
+func (e *Exporter) Write(fields collector.Fields, t time.Time) error {
+	if e.ServerTimestamp {
+		t = time.Time{}
+	}
+	line := lineprotocol.Encoder{Measurement: columnName(e.Table), Name: columnName}.Encode(fields, t)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.buf.WriteString(line); err != nil {
+		return err
+	}
+	return e.buf.Flush()
+}
+
+// Callback returns a collector.CollectStatsCallback writing every collection, logging
+// write errors.
+func (e *Exporter) Callback() collector.CollectStatsCallback {
+	return func(fields collector.Fields) {
+		if err := e.Write(fields, time.Now()); err != nil {
+			e.logger().Printf("questdb: writing point: %v", err)
+		}
+	}
+}
+
+// Close closes the connection.
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+func (e *Exporter) logger() Logger {
+	if e.Logger == nil {
+		return stdLogger{}
+	}
+	return e.Logger
+}
+
+func columnName(key string) string {
+	return strings.Replace(key, ".", "_", -1)
+}
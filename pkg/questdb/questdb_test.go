@@ -0,0 +1,80 @@
+package questdb
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+func TestExporter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	e, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	at := time.Unix(1600000000, 123)
+	fields := collector.New(nil).CollectStats()
+	if err := e.Write(fields, at); err != nil {
+		t.Fatal(err)
+	}
+	e.ServerTimestamp = true
+	if err := e.Write(fields, at); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(<-lines, " ")
+	if len(parts) != 3 {
+		t.Fatalf("unexpected line:\ngot: %q\nexp: <table,tags> <fields> <timestamp>", strings.Join(parts, " "))
+	}
+	if !strings.HasPrefix(parts[0], defaultTable+",") || !strings.Contains(parts[0], "go_os=") {
+		t.Errorf("unexpected table and tags: %s", parts[0])
+	}
+	columns := map[string]string{}
+	for _, field := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(field, "=", 2)
+		columns[kv[0]] = kv[1]
+	}
+	if _, ok := columns["mem_heap_alloc"]; !ok {
+		t.Errorf("expected column mem_heap_alloc, got %s", parts[1])
+	}
+	for k, v := range columns {
+		if strings.Contains(k, ".") {
+			t.Errorf("unexpected dot in column name (%s)", k)
+		}
+		if strings.HasSuffix(v, "u") {
+			t.Errorf("unexpected unsigned value for %s: %s", k, v)
+		}
+	}
+	if exp := strconv.FormatInt(at.UnixNano(), 10); parts[2] != exp {
+		t.Errorf("unexpected designated timestamp:\ngot: %s\nexp: %s", parts[2], exp)
+	}
+
+	if parts := strings.Split(<-lines, " "); len(parts) != 2 {
+		t.Errorf("expected no designated timestamp with ServerTimestamp, got %d parts", len(parts))
+	}
+}
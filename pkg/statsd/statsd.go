@@ -0,0 +1,214 @@
+// Package statsd writes runtime metrics as StatsD gauges over UDP, optionally with
+// DogStatsD tags for the Datadog agent.
+//
+//	e, err := statsd.RunCollector(&statsd.Config{DatadogMode: true})
+//	if err != nil {
+//		// handle error
+//	}
+//	defer e.Close()
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+const (
+	// DefaultAddr is the address of the StatsD and DogStatsD agents.
+	DefaultAddr = "localhost:8125"
+
+	defaultPrefix             = "go.runtime."
+	defaultCollectionInterval = 10 * time.Second
+
+	// defaultMaxPacketSize keeps datagrams within the Ethernet MTU.
+	defaultMaxPacketSize = 1432
+)
+
+// Config configures RunCollector and Dial.
+type Config struct {
+	// Address of the agent.
+	// Default is "localhost:8125".
+	Addr string
+
+	// Prefix of the gauge names.
+	// Default is "go.runtime.".
+	Prefix string
+
+	// Add Fields.Tags to every gauge as DogStatsD tags, "|#go.os:linux,...", which plain
+	// StatsD servers don't support.
+	// Default is false.
+	DatadogMode bool
+
+	// Maximum size of a datagram, the gauges of a collection are sent in as few
+	// datagrams as possible.
+	// Default is 1432 bytes.
+	MaxPacketSize int
+
+	// CollectionInterval is the interval between collections of RunCollector.
+	// Default is 10s.
+	CollectionInterval time.Duration
+
+	// Logger receives the write errors.
+	// Default is the standard logger of package log.
+	Logger Logger
+}
+
+// Exporter sends collected statistics as StatsD gauges, one per value of Fields.Values.
+// Boolean values are sent as 0 or 1, string values are omitted. It is safe for
+// concurrent use.
+type Exporter struct {
+	config Config
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Dial returns an Exporter sending to config.Addr.
+func Dial(config *Config) (*Exporter, error) {
+	c := Config{}
+	if config != nil {
+		c = *config
+	}
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.Prefix == "" {
+		c.Prefix = defaultPrefix
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = defaultMaxPacketSize
+	}
+	if c.CollectionInterval < 0 {
+		return nil, fmt.Errorf("statsd: negative CollectionInterval %s", c.CollectionInterval)
+	}
+	if c.CollectionInterval == 0 {
+		c.CollectionInterval = defaultCollectionInterval
+	}
+	if c.Logger == nil {
+		c.Logger = stdLogger{}
+	}
+
+	conn, err := net.Dial("udp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{config: c, conn: conn, done: make(chan struct{})}, nil
+}
+
+// RunCollector runs a collector every CollectionInterval sending to the returned
+// Exporter until it is closed.
+func RunCollector(config *Config) (*Exporter, error) {
+	e, err := Dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := collector.New(e.Callback())
+	c.PauseDur = e.config.CollectionInterval
+	c.Done = e.done
+	go c.Run()
+
+	return e, nil
+}
+
+// Write sends the gauges of fields.
+func (e *Exporter) Write(fields collector.Fields) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, packet := range e.packets(fields) {
+		if _, err := e.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Callback returns a collector.CollectStatsCallback sending every collection, logging
+// write errors.
+func (e *Exporter) Callback() collector.CollectStatsCallback {
+	return func(fields collector.Fields) {
+		if err := e.Write(fields); err != nil {
+			e.config.Logger.Printf("statsd: writing gauges: %v", err)
+		}
+	}
+}
+
+// Close stops the collector started by RunCollector, if any, and closes the
+// connection. It may be called more than once.
+func (e *Exporter) Close() error {
+	var err error
+	e.stopOnce.Do(func() {
+		close(e.done)
+		e.mu.Lock()
+		err = e.conn.Close()
+		e.mu.Unlock()
+	})
+	return err
+}
+
+// packets formats the gauges of fields, in key order, into datagrams of at most
+// MaxPacketSize bytes, unless a single gauge exceeds it.
+func (e *Exporter) packets(fields collector.Fields) [][]byte {
+	var tags string
+	if e.config.DatadogMode {
+		tags = formatTags(fields.Tags())
+	}
+
+	values := fields.Values()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, k := range keys {
+		value, ok := collector.FormatValue(k, values[k])
+		if !ok {
+			continue
+		}
+
+		line := e.config.Prefix + k + ":" + value + "|g" + tags
+		if buf.Len() > 0 && buf.Len()+1+len(line) > e.config.MaxPacketSize {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+// formatTags returns the DogStatsD tag suffix of tags, in key order.
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, tagEscaper.Replace(k)+":"+tagEscaper.Replace(v))
+	}
+	sort.Strings(pairs)
+	return "|#" + strings.Join(pairs, ",")
+}
+
+// tagEscaper replaces the separators of the DogStatsD format in tags.
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
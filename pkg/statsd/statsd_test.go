@@ -0,0 +1,96 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+)
+
+func listen(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func read(t *testing.T, conn *net.UDPConn) string {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestWrite(t *testing.T) {
+	server := listen(t)
+	defer server.Close()
+
+	e, err := Dial(&Config{Addr: server.LocalAddr().String(), DatadogMode: true, MaxPacketSize: 8192})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	fields := collector.Fields{NumGoroutine: 3, GCCPUFraction: 0.25, Goos: "linux", Goarch: "amd64", Version: "go1,x"}
+	if err := e.Write(fields); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := read(t, server)
+	tags := "|#go.arch:amd64,go.os:linux,go.version:go1_x"
+	for _, exp := range []string{
+		"go.runtime.cpu.goroutines:3|g" + tags + "\n",
+		"go.runtime.mem.gc.cpu_fraction:0.25|g" + tags + "\n",
+	} {
+		if !strings.Contains(packet, exp) {
+			t.Errorf("expected %q in:\n%s", exp, packet)
+		}
+	}
+	if n := len(fields.Values()); strings.Count(packet, "\n") != n-1 {
+		t.Errorf("expected the %d gauges in one datagram:\n%s", n, packet)
+	}
+}
+
+func TestPacketBatching(t *testing.T) {
+	e := &Exporter{config: Config{Prefix: "app.", MaxPacketSize: 100}}
+	fields := collector.Fields{NumGoroutine: 3}
+
+	packets := e.packets(fields)
+	if len(packets) < 2 {
+		t.Fatalf("expected several datagrams, got %d", len(packets))
+	}
+	lines := 0
+	for _, p := range packets {
+		if len(p) > 100 {
+			t.Errorf("datagram exceeds MaxPacketSize: %d bytes", len(p))
+		}
+		if strings.Contains(string(p), "|#") {
+			t.Error("unexpected tags without DatadogMode")
+		}
+		lines += strings.Count(string(p), "\n") + 1
+	}
+	if n := len(fields.Values()); lines != n {
+		t.Errorf("unexpected number of gauges:\ngot: %d\nexp: %d", lines, n)
+	}
+}
+
+func TestRunCollector(t *testing.T) {
+	server := listen(t)
+	defer server.Close()
+
+	e, err := RunCollector(&Config{Addr: server.LocalAddr().String(), CollectionInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if packet := read(t, server); !strings.HasPrefix(packet, defaultPrefix) {
+		t.Errorf("unexpected datagram:\n%s", packet)
+	}
+}
@@ -0,0 +1,113 @@
+// Package unixgram writes runtime metrics to a Unix datagram socket, e.g. of a local
+// agent, one point per datagram, avoiding the TCP and HTTP overhead for co-located
+// ingestion.
+package unixgram
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/lineprotocol"
+)
+
+// Formats of the datagrams.
+const (
+	// LineProtocol formats points as InfluxDB line protocol.
+	LineProtocol = "line"
+
+	// JSON formats points as influxdb.Point, like the expvar variable.
+	JSON = "json"
+)
+
+// Exporter writes collected statistics to a Unix datagram socket. The socket is
+// connected lazily: while it doesn't exist, e.g. because the agent hasn't started yet,
+// points are dropped and the connection is retried on the next write. It is safe for
+// concurrent use.
+type Exporter struct {
+	// Path of the socket.
+	Path string
+
+	// Measurement of the points.
+	Measurement string
+
+	// Format of the datagrams, LineProtocol or JSON. Defaults to LineProtocol.
+	Format string
+
+	// Logger receives the write errors of Callback. Defaults to the standard logger.
+	Logger Logger
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// New returns an Exporter writing points of measurement to the socket at path.
+func New(path, measurement string) *Exporter {
+	return &Exporter{Path: path, Measurement: measurement, Format: LineProtocol}
+}
+
+// Write writes fields collected at t as one datagram.
+func (e *Exporter) Write(fields collector.Fields, t time.Time) error {
+	datagram, err := e.format(fields, t)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: e.Path, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+	if _, err := e.conn.Write(datagram); err != nil {
+		// the agent may have restarted with a new socket, reconnect on the next write
+		e.conn.Close()
+		e.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Callback returns a collector.CollectStatsCallback writing every collection, logging
+// write errors.
+func (e *Exporter) Callback() collector.CollectStatsCallback {
+	return func(fields collector.Fields) {
+		if err := e.Write(fields, time.Now()); err != nil {
+			e.logger().Printf("unixgram: writing point: %v", err)
+		}
+	}
+}
+
+// Close closes the connection, if any.
+func (e *Exporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+func (e *Exporter) format(fields collector.Fields, t time.Time) ([]byte, error) {
+	if e.Format == JSON {
+		return json.Marshal(influxdb.Point{Name: e.Measurement, Tags: fields.Tags(), Values: fields})
+	}
+	return []byte(lineprotocol.Encoder{Measurement: e.Measurement}.Encode(fields, t)), nil
+}
+
+func (e *Exporter) logger() Logger {
+	if e.Logger == nil {
+		return stdLogger{}
+	}
+	return e.Logger
+}
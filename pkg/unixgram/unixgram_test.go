@@ -0,0 +1,73 @@
+package unixgram
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/collector"
+	"github.com/sam-kamerer/go-runtime-metrics/v2/pkg/influxdb"
+)
+
+func TestExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unixgram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	e := New(path, "test")
+	defer e.Close()
+	fields := collector.New(nil).CollectStats()
+	at := time.Unix(1600000000, 0)
+
+	if err := e.Write(fields, at); err == nil {
+		t.Error("expected error while the socket doesn't exist")
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := e.Write(fields, at); err != nil {
+		t.Fatalf("unexpected error once the socket exists: %v", err)
+	}
+	e.Format = JSON
+	if err := e.Write(fields, at); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(buf[:n])
+	if !strings.HasPrefix(line, "test,") || !strings.Contains(line, "mem.heap.alloc=") {
+		t.Errorf("unexpected line protocol datagram: %s", line)
+	}
+	if exp := " " + strconv.FormatInt(at.UnixNano(), 10) + "\n"; !strings.HasSuffix(line, exp) {
+		t.Errorf("unexpected timestamp in datagram: %s", line)
+	}
+
+	n, err = conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := influxdb.Point{}
+	if err := json.Unmarshal(buf[:n], &point); err != nil {
+		t.Fatalf("unexpected JSON datagram: %v", err)
+	}
+	if point.Name != "test" || point.Values.HeapAlloc != fields.HeapAlloc {
+		t.Errorf("unexpected JSON point:\ngot: %s %d\nexp: test %d", point.Name, point.Values.HeapAlloc, fields.HeapAlloc)
+	}
+}